@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Anurag-spec1/goauthenticate/services"
+)
+
+func emailCommand() *cobra.Command {
+    var locale string
+
+    test := &cobra.Command{
+        Use:   "test ADDRESS",
+        Short: "Send a welcome email to check delivery and templates",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx, cancel := commandContext()
+            defer cancel()
+
+            emails := services.NewEmailService(cfg.Email)
+            provider, err := emails.CheckConfig()
+            if err != nil {
+                return err
+            }
+            if err := emails.SendWelcomeEmail(ctx, args[0], "Test User", services.ResolveLocale(locale, "")); err != nil {
+                return err
+            }
+            fmt.Printf("Sent test email to %s via %s\n", args[0], provider)
+            return nil
+        },
+    }
+    test.Flags().StringVar(&locale, "locale", services.DefaultLocale, "template locale")
+
+    cmd := &cobra.Command{
+        Use:   "email",
+        Short: "Check outgoing email",
+    }
+    cmd.AddCommand(test)
+    return cmd
+}
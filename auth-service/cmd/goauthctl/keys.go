@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Anurag-spec1/goauthenticate/services"
+)
+
+func keyCommand() *cobra.Command {
+    cmd := &cobra.Command{
+        Use:   "key",
+        Short: "Manage ID token signing keys",
+    }
+    cmd.AddCommand(&cobra.Command{
+        Use:   "rotate",
+        Short: "Start signing with a new key",
+        Long:  "Start signing ID tokens with a new key. Old keys stay published so tokens they signed keep verifying. Running servers pick the new key up within a minute.",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            connect()
+            kid, err := services.NewKeyService().Rotate()
+            if err != nil {
+                return err
+            }
+            fmt.Printf("New signing key %s\n", kid)
+            return nil
+        },
+    })
+    return cmd
+}
@@ -0,0 +1,83 @@
+// Command goauthctl does operational tasks against the same database and
+// configuration as the server: managing users and sessions, revoking
+// tokens, rotating signing keys, testing email and running migrations.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Anurag-spec1/goauthenticate/config"
+)
+
+// Operations get this long before they are abandoned
+const commandTimeout = time.Minute
+
+// connected is set once a command has needed the database
+var connected bool
+
+func main() {
+    var configFile string
+
+    root := &cobra.Command{
+        Use:           "goauthctl",
+        Short:         "Operate a goauthenticate deployment",
+        SilenceUsage:  true,
+        SilenceErrors: true,
+        // Same configuration as the server: .env, CONFIG_FILE, environment
+        PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+            if configFile != "" {
+                os.Setenv("CONFIG_FILE", configFile)
+            }
+            var err error
+            cfg, err = config.Load()
+            if err != nil {
+                return fmt.Errorf("invalid configuration:\n%w", err)
+            }
+            return nil
+        },
+    }
+    root.PersistentFlags().StringVar(&configFile, "config", "", "configuration file (overrides CONFIG_FILE)")
+
+    root.AddCommand(
+        userCommand(),
+        sessionCommand(),
+        tokenCommand(),
+        keyCommand(),
+        emailCommand(),
+        migrateCommand(),
+    )
+
+    err := root.Execute()
+    if connected {
+        config.DisconnectDB()
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        os.Exit(1)
+    }
+}
+
+// cfg is loaded before any command runs
+var cfg *config.Config
+
+// connect opens the database for commands that need it
+func connect() {
+    config.ConnectDB(cfg.Mongo)
+    connected = true
+}
+
+func commandContext() (context.Context, context.CancelFunc) {
+    return context.WithTimeout(context.Background(), commandTimeout)
+}
+
+func formatTime(t time.Time) string {
+    if t.IsZero() {
+        return "-"
+    }
+    return t.Local().Format(time.RFC3339)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/Anurag-spec1/goauthenticate/config"
+	"github.com/Anurag-spec1/goauthenticate/migrations"
+)
+
+func migrateCommand() *cobra.Command {
+    return migrations.Command(func() *mongo.Database {
+        connect()
+        return config.DB
+    })
+}
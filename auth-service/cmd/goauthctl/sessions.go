@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Anurag-spec1/goauthenticate/services"
+)
+
+func sessionCommand() *cobra.Command {
+    cmd := &cobra.Command{
+        Use:   "session",
+        Short: "Inspect user sessions",
+    }
+    cmd.AddCommand(&cobra.Command{
+        Use:   "list [USER]",
+        Short: "List current sessions, for one user or everyone",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            connect()
+            ctx, cancel := commandContext()
+            defer cancel()
+
+            users := services.NewUserService(cfg.JWT)
+            var userID *primitive.ObjectID
+            if len(args) == 1 {
+                user, err := users.Find(ctx, args[0])
+                if err != nil {
+                    return err
+                }
+                userID = &user.ID
+            }
+
+            sessions, err := users.Sessions(ctx, userID)
+            if err != nil {
+                return err
+            }
+
+            w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+            fmt.Fprintln(w, "USER ID\tEMAIL\tTOKEN ID\tISSUED AT\tEXPIRES AT")
+            for _, s := range sessions {
+                fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.UserID.Hex(), s.Email, s.TokenID, formatTime(s.IssuedAt), formatTime(s.ExpiresAt))
+            }
+            return w.Flush()
+        },
+    })
+    return cmd
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Anurag-spec1/goauthenticate/models"
+	"github.com/Anurag-spec1/goauthenticate/services"
+	"github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// USER arguments are an email address or a user ID
+func userCommand() *cobra.Command {
+    cmd := &cobra.Command{
+        Use:   "user",
+        Short: "Create, suspend and delete users",
+    }
+    cmd.AddCommand(userCreateCommand(), userSuspendCommand(), userUnsuspendCommand(), userDeleteCommand())
+    return cmd
+}
+
+func userCreateCommand() *cobra.Command {
+    var name, role string
+    var verified bool
+
+    cmd := &cobra.Command{
+        Use:   "create EMAIL",
+        Short: "Create a user",
+        Long:  "Create a user. College addresses get their roll number, branch and batch filled in as on sign-up.",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if role != "" && role != models.RoleAdmin {
+                return fmt.Errorf("unknown role %q", role)
+            }
+
+            user := &models.User{Email: args[0], Role: role, IsVerified: verified}
+            if info := utils.ParseCollegeEmail(args[0]); info.IsValidFormat {
+                user.Name = info.Name
+                user.RollNumber = info.RollNumber
+                user.Branch = info.Branch
+                user.AdmissionYear = info.AdmissionYear
+                user.CurrentYear = info.CurrentYear
+                user.YearNumber = info.YearNumber
+                user.Batch = info.Batch
+            }
+            if name != "" {
+                user.Name = name
+            }
+
+            connect()
+            ctx, cancel := commandContext()
+            defer cancel()
+
+            if _, err := services.NewUserService(cfg.JWT).Find(ctx, user.Email); err == nil {
+                return fmt.Errorf("a user with email %s already exists", user.Email)
+            } else if !errors.Is(err, services.ErrUserNotFound) {
+                return err
+            }
+
+            if err := services.NewUserService(cfg.JWT).Create(ctx, user); err != nil {
+                return err
+            }
+            fmt.Printf("Created user %s (%s)\n", user.ID.Hex(), user.Email)
+            return nil
+        },
+    }
+    cmd.Flags().StringVar(&name, "name", "", "display name (default taken from the email)")
+    cmd.Flags().StringVar(&role, "role", "", `role to grant ("admin")`)
+    cmd.Flags().BoolVar(&verified, "verified", false, "mark the email as already verified")
+    return cmd
+}
+
+func userSuspendCommand() *cobra.Command {
+    var reason string
+    var notify bool
+
+    cmd := &cobra.Command{
+        Use:   "suspend USER",
+        Short: "Stop a user logging in and end their session",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            connect()
+            ctx, cancel := commandContext()
+            defer cancel()
+
+            users := services.NewUserService(cfg.JWT)
+            user, err := users.Find(ctx, args[0])
+            if err != nil {
+                return err
+            }
+            if err := users.Suspend(ctx, user, reason); err != nil {
+                return err
+            }
+            fmt.Printf("Suspended %s (%s)\n", user.ID.Hex(), user.Email)
+
+            if notify {
+                locale := services.ResolveLocale(user.Locale, "")
+                if err := services.NewEmailService(cfg.Email).SendAccountSuspendedEmail(ctx, user.Email, user.Name, locale, reason); err != nil {
+                    return fmt.Errorf("suspended, but the email to the user failed: %w", err)
+                }
+            }
+            return nil
+        },
+    }
+    cmd.Flags().StringVar(&reason, "reason", "", "why, for the audit trail and the email to the user")
+    cmd.Flags().BoolVar(&notify, "notify", true, "email the user about the suspension")
+    return cmd
+}
+
+func userUnsuspendCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "unsuspend USER",
+        Short: "Let a suspended user log in again",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            connect()
+            ctx, cancel := commandContext()
+            defer cancel()
+
+            users := services.NewUserService(cfg.JWT)
+            user, err := users.Find(ctx, args[0])
+            if err != nil {
+                return err
+            }
+            if err := users.Unsuspend(ctx, user); err != nil {
+                return err
+            }
+            fmt.Printf("Unsuspended %s (%s)\n", user.ID.Hex(), user.Email)
+            return nil
+        },
+    }
+}
+
+func userDeleteCommand() *cobra.Command {
+    var yes bool
+
+    cmd := &cobra.Command{
+        Use:   "delete USER",
+        Short: "Delete a user, their session and pending OTPs",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if !yes {
+                return errors.New("deleting a user can't be undone, pass --yes to go ahead")
+            }
+
+            connect()
+            ctx, cancel := commandContext()
+            defer cancel()
+
+            users := services.NewUserService(cfg.JWT)
+            user, err := users.Find(ctx, args[0])
+            if err != nil {
+                return err
+            }
+            if err := users.Delete(ctx, user); err != nil {
+                return err
+            }
+            fmt.Printf("Deleted %s (%s)\n", user.ID.Hex(), user.Email)
+            return nil
+        },
+    }
+    cmd.Flags().BoolVar(&yes, "yes", false, "confirm the deletion")
+    return cmd
+}
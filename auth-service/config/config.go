@@ -0,0 +1,550 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "log/slog"
+    "net"
+    "net/url"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/joho/godotenv"
+    "github.com/pelletier/go-toml/v2"
+    "gopkg.in/yaml.v3"
+)
+
+// Config is everything the server needs to start. It is built by Load from
+// defaults, then an optional YAML or TOML file, then environment variables.
+type Config struct {
+    Server    ServerConfig    `yaml:"server" toml:"server"`
+    Mongo     MongoConfig     `yaml:"mongo" toml:"mongo"`
+    JWT       JWTConfig       `yaml:"jwt" toml:"jwt"`
+    OTP       OTPConfig       `yaml:"otp" toml:"otp"`
+    MFA       MFAConfig       `yaml:"mfa" toml:"mfa"`
+    Email     EmailConfig     `yaml:"email" toml:"email"`
+    CORS      CORSConfig      `yaml:"cors" toml:"cors"`
+    RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+    Log       LogConfig       `yaml:"log" toml:"log"`
+    Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+    Admin     AdminConfig     `yaml:"admin" toml:"admin"`
+    Privacy   PrivacyConfig   `yaml:"privacy" toml:"privacy"`
+    Challenge ChallengeConfig `yaml:"challenge" toml:"challenge"`
+    MagicLink MagicLinkConfig `yaml:"magic_link" toml:"magic_link"`
+    OIDC      OIDCConfig      `yaml:"oidc" toml:"oidc"`
+    Device    DeviceConfig    `yaml:"device" toml:"device"`
+    WebAuthn  WebAuthnConfig  `yaml:"webauthn" toml:"webauthn"`
+}
+
+type ServerConfig struct {
+    Port               int      `yaml:"port" toml:"port" env:"PORT"`
+    GinMode            string   `yaml:"gin_mode" toml:"gin_mode" env:"GIN_MODE"`
+    MetricsAddr        string   `yaml:"metrics_addr" toml:"metrics_addr" env:"METRICS_ADDR"`
+    TrustedProxies     []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+    ShutdownDrainDelay Duration `yaml:"shutdown_drain_delay" toml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+    ShutdownTimeout    Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+type MongoConfig struct {
+    URI         string `yaml:"uri" toml:"uri" env:"MONGO_URI"`
+    Database    string `yaml:"database" toml:"database" env:"DB_NAME"`
+    MaxPoolSize int    `yaml:"max_pool_size" toml:"max_pool_size" env:"MONGO_MAX_POOL_SIZE"`
+    MinPoolSize int    `yaml:"min_pool_size" toml:"min_pool_size" env:"MONGO_MIN_POOL_SIZE"`
+    AutoMigrate bool   `yaml:"auto_migrate" toml:"auto_migrate" env:"MONGO_AUTO_MIGRATE"` // apply pending migrations at startup
+}
+
+type JWTConfig struct {
+    AccessSecret    string   `yaml:"access_secret" toml:"access_secret" env:"ACCESS_SECRET"`
+    RefreshSecret   string   `yaml:"refresh_secret" toml:"refresh_secret" env:"REFRESH_SECRET"`
+    MagicLinkSecret string   `yaml:"magic_link_secret" toml:"magic_link_secret" env:"MAGIC_LINK_SECRET"` // defaults to the access secret
+    AccessTTL       Duration `yaml:"access_ttl" toml:"access_ttl" env:"ACCESS_TOKEN_TTL"`
+    RefreshTTL      Duration `yaml:"refresh_ttl" toml:"refresh_ttl" env:"REFRESH_TOKEN_TTL"`
+    MFATTL          Duration `yaml:"mfa_ttl" toml:"mfa_ttl" env:"MFA_TOKEN_TTL"` // how long a user has to present their second factor
+}
+
+// OTPConfig is the one-time code policy. It drives generation, checking,
+// the database expiry and what the email tells the user.
+type OTPConfig struct {
+    Length      int      `yaml:"length" toml:"length" env:"OTP_LENGTH"`
+    Alphabet    string   `yaml:"alphabet" toml:"alphabet" env:"OTP_ALPHABET"` // numeric or alphanumeric
+    Lifetime    Duration `yaml:"lifetime" toml:"lifetime" env:"OTP_LIFETIME"`
+    MaxAttempts int      `yaml:"max_attempts" toml:"max_attempts" env:"OTP_MAX_ATTEMPTS"`
+}
+
+const (
+    OTPNumeric      = "numeric"
+    OTPAlphanumeric = "alphanumeric"
+)
+
+// MFAConfig limits guessing of second-factor codes. After MaxAttempts wrong
+// codes in a row the user is locked out of MFA for Lockout.
+type MFAConfig struct {
+    MaxAttempts int      `yaml:"max_attempts" toml:"max_attempts" env:"MFA_MAX_ATTEMPTS"`
+    Lockout     Duration `yaml:"lockout" toml:"lockout" env:"MFA_LOCKOUT"`
+}
+
+type EmailConfig struct {
+    Provider     string `yaml:"provider" toml:"provider" env:"EMAIL_PROVIDER"` // resend, or simulation to print emails
+    From         string `yaml:"from" toml:"from" env:"EMAIL_FROM"`
+    ResendAPIKey string `yaml:"resend_api_key" toml:"resend_api_key" env:"RESEND_API_KEY"`
+    TemplateDir  string `yaml:"template_dir" toml:"template_dir" env:"EMAIL_TEMPLATE_DIR"`
+    BrandingFile string `yaml:"branding_file" toml:"branding_file" env:"EMAIL_BRANDING_FILE"`
+}
+
+type CORSConfig struct {
+    AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+    AllowedMethods []string `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+    AllowedHeaders []string `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+    ExposedHeaders []string `yaml:"exposed_headers" toml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+}
+
+type RateLimitConfig struct {
+    Backend string              `yaml:"backend" toml:"backend" env:"RATE_LIMIT_BACKEND"` // memory (per instance) or mongo (shared)
+    Rules   map[string]RateRule `yaml:"rules" toml:"rules"`                             // overrides by limiter name, e.g. "request-otp-ip"
+}
+
+type RateRule struct {
+    Limit  int      `yaml:"limit" toml:"limit"`
+    Window Duration `yaml:"window" toml:"window"`
+}
+
+type LogConfig struct {
+    Level string `yaml:"level" toml:"level" env:"LOG_LEVEL"` // debug, info, warn or error
+}
+
+// TracingConfig picks the OpenTelemetry exporter. Other OTEL_EXPORTER_OTLP_*
+// variables are read by the exporter itself.
+type TracingConfig struct {
+    Exporter     string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER"` // otlp, stdout or none; otlp when an endpoint is set
+    OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+    ServiceName  string `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME"`
+}
+
+// AdminConfig lists emails that are admins whatever their role, which is
+// how the first admin gets in
+type AdminConfig struct {
+    Emails []string `yaml:"emails" toml:"emails" env:"ADMIN_EMAILS"`
+}
+
+// PrivacyConfig hides whether an account exists. In privacy mode the OTP
+// endpoints answer identically either way, no sooner than MinResponseMS.
+type PrivacyConfig struct {
+    Mode          bool `yaml:"mode" toml:"mode" env:"PRIVACY_MODE"`
+    MinResponseMS int  `yaml:"min_response_ms" toml:"min_response_ms" env:"PRIVACY_MIN_RESPONSE_MS"`
+}
+
+// ChallengeConfig decides when OTP requests must solve a challenge and
+// what kind. With a CAPTCHA provider the challenge is a CAPTCHA, otherwise
+// proof-of-work.
+type ChallengeConfig struct {
+    Mode            string   `yaml:"mode" toml:"mode" env:"CHALLENGE_MODE"`                // adaptive, always or off
+    Threshold       int      `yaml:"threshold" toml:"threshold" env:"CHALLENGE_THRESHOLD"` // OTP requests a minute before adaptive mode asks
+    EmailThreshold  int      `yaml:"email_threshold" toml:"email_threshold" env:"CHALLENGE_EMAIL_THRESHOLD"` // OTP requests for one email per email_window before adaptive mode asks
+    EmailWindow     Duration `yaml:"email_window" toml:"email_window" env:"CHALLENGE_EMAIL_WINDOW"`
+    Secret          string   `yaml:"secret" toml:"secret" env:"CHALLENGE_SECRET"`          // defaults to a key derived from the access secret
+    PoWBits         int      `yaml:"pow_bits" toml:"pow_bits" env:"CHALLENGE_POW_BITS"`
+    CaptchaProvider string   `yaml:"captcha_provider" toml:"captcha_provider" env:"CAPTCHA_PROVIDER"` // turnstile, hcaptcha or recaptcha
+    CaptchaSecret   string   `yaml:"captcha_secret" toml:"captcha_secret" env:"CAPTCHA_SECRET"`
+    CaptchaSiteKey  string   `yaml:"captcha_site_key" toml:"captcha_site_key" env:"CAPTCHA_SITE_KEY"`
+}
+
+const (
+    ChallengeAdaptive = "adaptive"
+    ChallengeAlways   = "always"
+    ChallengeOff      = "off"
+)
+
+// MagicLinkConfig turns on login links in OTP emails. Without a
+// RedirectURL only codes are sent.
+type MagicLinkConfig struct {
+    RedirectURL  string `yaml:"redirect_url" toml:"redirect_url" env:"MAGIC_LINK_REDIRECT_URL"`
+    BaseURL      string `yaml:"base_url" toml:"base_url" env:"MAGIC_LINK_BASE_URL"`                // this service's public origin, required with redirect_url
+    ResponseMode string `yaml:"response_mode" toml:"response_mode" env:"MAGIC_LINK_RESPONSE_MODE"` // code or tokens
+}
+
+const (
+    MagicLinkCode   = "code"
+    MagicLinkTokens = "tokens"
+)
+
+type OIDCConfig struct {
+    Issuer            string `yaml:"issuer" toml:"issuer" env:"OIDC_ISSUER"`          // this service's public origin, e.g. https://auth.example.edu
+    LoginURL          string `yaml:"login_url" toml:"login_url" env:"OIDC_LOGIN_URL"` // where /oauth/authorize sends users to sign in
+    RegistrationToken string `yaml:"registration_token" toml:"registration_token" env:"OIDC_REGISTRATION_TOKEN"` // empty turns off dynamic registration
+}
+
+// DeviceConfig turns on the device grant. Without a VerificationURL for
+// users to enter codes on, it is off.
+type DeviceConfig struct {
+    VerificationURL string `yaml:"verification_url" toml:"verification_url" env:"DEVICE_VERIFICATION_URL"`
+}
+
+// WebAuthnConfig describes the relying party passkeys are bound to
+type WebAuthnConfig struct {
+    RPID      string   `yaml:"rp_id" toml:"rp_id" env:"WEBAUTHN_RP_ID"`
+    RPName    string   `yaml:"rp_name" toml:"rp_name" env:"WEBAUTHN_RP_NAME"` // defaults to the email branding's product name
+    RPOrigins []string `yaml:"rp_origins" toml:"rp_origins" env:"WEBAUTHN_RP_ORIGINS"`
+}
+
+// Duration reads as a Go duration string such as "15m" or "168h"
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration {
+    return time.Duration(d)
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+    parsed, err := time.ParseDuration(string(text))
+    if err != nil {
+        return err
+    }
+    *d = Duration(parsed)
+    return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+    return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns the configuration used for anything not set elsewhere
+func Default() *Config {
+    return &Config{
+        Server: ServerConfig{
+            Port:               8080,
+            GinMode:            "debug",
+            ShutdownDrainDelay: Duration(5 * time.Second),
+            ShutdownTimeout:    Duration(5 * time.Second),
+        },
+        Mongo: MongoConfig{
+            Database:    "auth_db",
+            MaxPoolSize: 100,
+            MinPoolSize: 5,
+            AutoMigrate: true,
+        },
+        JWT: JWTConfig{
+            AccessTTL:  Duration(15 * time.Minute),
+            RefreshTTL: Duration(7 * 24 * time.Hour),
+            MFATTL:     Duration(5 * time.Minute),
+        },
+        OTP: OTPConfig{
+            Length:      6,
+            Alphabet:    OTPNumeric,
+            Lifetime:    Duration(10 * time.Minute),
+            MaxAttempts: 5,
+        },
+        MFA: MFAConfig{
+            MaxAttempts: 5,
+            Lockout:     Duration(15 * time.Minute),
+        },
+        Email: EmailConfig{
+            Provider: "simulation",
+            From:     "onboarding@resend.dev",
+        },
+        CORS: CORSConfig{
+            AllowedOrigins: []string{"*"},
+            AllowedMethods: []string{"POST", "GET", "OPTIONS", "PUT", "DELETE"},
+            AllowedHeaders: []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "X-Request-ID", "traceparent", "tracestate"},
+            ExposedHeaders: []string{"X-Request-ID", "RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+        },
+        RateLimit: RateLimitConfig{
+            Backend: "memory",
+        },
+        Log: LogConfig{
+            Level: "info",
+        },
+        Tracing: TracingConfig{
+            ServiceName: "goauthenticate",
+        },
+        Privacy: PrivacyConfig{
+            MinResponseMS: 400,
+        },
+        Challenge: ChallengeConfig{
+            Mode:           ChallengeAdaptive,
+            Threshold:      60,
+            EmailThreshold: 3,
+            EmailWindow:    Duration(15 * time.Minute),
+            PoWBits:        18,
+        },
+        MagicLink: MagicLinkConfig{
+            ResponseMode: MagicLinkCode,
+        },
+        WebAuthn: WebAuthnConfig{
+            RPID:      "localhost",
+            RPOrigins: []string{"http://localhost:8080"},
+        },
+    }
+}
+
+// Load builds the configuration. The .env file is read first (outside
+// production) so it can point CONFIG_FILE at a YAML or TOML file; that file
+// is applied over the defaults, and environment variables over the file.
+// Any variable can instead be given as NAME_FILE holding a path to read the
+// value from, for secrets mounted as files. All validation problems are
+// returned together.
+func Load() (*Config, error) {
+    if os.Getenv("GO_ENV") != "production" {
+        // A missing .env is normal; the environment may have everything
+        _ = godotenv.Load()
+    }
+
+    cfg := Default()
+
+    if path := os.Getenv("CONFIG_FILE"); path != "" {
+        if err := cfg.loadFile(path); err != nil {
+            return nil, err
+        }
+    }
+
+    envErr := applyEnv(reflect.ValueOf(cfg).Elem())
+
+    if cfg.JWT.MagicLinkSecret == "" {
+        cfg.JWT.MagicLinkSecret = cfg.JWT.AccessSecret
+    }
+    if cfg.Tracing.Exporter == "" {
+        cfg.Tracing.Exporter = "none"
+        if cfg.Tracing.OTLPEndpoint != "" {
+            cfg.Tracing.Exporter = "otlp"
+        }
+    }
+
+    if err := errors.Join(envErr, cfg.Validate()); err != nil {
+        return nil, err
+    }
+    return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("reading config file: %w", err)
+    }
+
+    switch ext := strings.ToLower(filepath.Ext(path)); ext {
+    case ".yaml", ".yml":
+        err = yaml.Unmarshal(data, cfg)
+    case ".toml":
+        err = toml.Unmarshal(data, cfg)
+    default:
+        return fmt.Errorf("config file %s: unsupported format %q, use .yaml, .yml or .toml", path, ext)
+    }
+    if err != nil {
+        return fmt.Errorf("parsing config file %s: %w", path, err)
+    }
+    return nil
+}
+
+// applyEnv sets every field with an env tag whose variable (or its _FILE
+// variant) is set. Lists are comma separated.
+func applyEnv(v reflect.Value) error {
+    var errs []error
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field, value := t.Field(i), v.Field(i)
+        if field.Type.Kind() == reflect.Struct && field.Tag.Get("env") == "" {
+            if err := applyEnv(value); err != nil {
+                errs = append(errs, err)
+            }
+            continue
+        }
+
+        name := field.Tag.Get("env")
+        if name == "" {
+            continue
+        }
+        raw, ok, err := lookupEnv(name)
+        if err != nil {
+            errs = append(errs, err)
+            continue
+        }
+        if !ok {
+            continue
+        }
+        if err := setField(value, raw); err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", name, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+func lookupEnv(name string) (string, bool, error) {
+    if path := os.Getenv(name + "_FILE"); path != "" {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+        }
+        return strings.TrimRight(string(data), "\r\n"), true, nil
+    }
+    raw, ok := os.LookupEnv(name)
+    return raw, ok && raw != "", nil
+}
+
+func setField(value reflect.Value, raw string) error {
+    if u, ok := value.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+        return u.UnmarshalText([]byte(raw))
+    }
+
+    switch value.Kind() {
+    case reflect.String:
+        value.SetString(raw)
+    case reflect.Int:
+        n, err := strconv.Atoi(raw)
+        if err != nil {
+            return err
+        }
+        value.SetInt(int64(n))
+    case reflect.Bool:
+        b, err := strconv.ParseBool(raw)
+        if err != nil {
+            return err
+        }
+        value.SetBool(b)
+    case reflect.Slice:
+        var items []string
+        for _, item := range strings.Split(raw, ",") {
+            if item = strings.TrimSpace(item); item != "" {
+                items = append(items, item)
+            }
+        }
+        value.Set(reflect.ValueOf(items))
+    default:
+        return fmt.Errorf("unsupported field type %s", value.Type())
+    }
+    return nil
+}
+
+// Validate checks the whole configuration and reports every problem at once
+func (cfg *Config) Validate() error {
+    var errs []error
+    check := func(ok bool, format string, args ...interface{}) {
+        if !ok {
+            errs = append(errs, fmt.Errorf(format, args...))
+        }
+    }
+
+    check(cfg.Server.Port > 0 && cfg.Server.Port < 65536, "server.port: %d is not a valid port", cfg.Server.Port)
+    check(cfg.Server.GinMode == "debug" || cfg.Server.GinMode == "release" || cfg.Server.GinMode == "test",
+        "server.gin_mode: must be debug, release or test, got %q", cfg.Server.GinMode)
+    check(cfg.Server.ShutdownDrainDelay >= 0, "server.shutdown_drain_delay: must not be negative")
+    check(cfg.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+    for _, entry := range cfg.Server.TrustedProxies {
+        _, _, cidrErr := net.ParseCIDR(entry)
+        check(cidrErr == nil || net.ParseIP(entry) != nil, "server.trusted_proxies: %q is not an IP or CIDR", entry)
+    }
+
+    check(cfg.Mongo.URI != "", "mongo.uri: required (MONGO_URI)")
+    check(cfg.Mongo.Database != "", "mongo.database: required (DB_NAME)")
+    check(cfg.Mongo.MinPoolSize >= 0 && cfg.Mongo.MaxPoolSize >= cfg.Mongo.MinPoolSize,
+        "mongo: pool sizes must satisfy 0 <= min_pool_size <= max_pool_size")
+
+    check(cfg.JWT.AccessSecret != "", "jwt.access_secret: required (ACCESS_SECRET)")
+    check(cfg.JWT.RefreshSecret != "", "jwt.refresh_secret: required (REFRESH_SECRET)")
+    check(cfg.JWT.AccessSecret == "" || cfg.JWT.AccessSecret != cfg.JWT.RefreshSecret,
+        "jwt: access_secret and refresh_secret must differ")
+    if cfg.Server.GinMode == "release" {
+        check(len(cfg.JWT.AccessSecret) >= 32, "jwt.access_secret: must be at least 32 bytes in release mode")
+        check(len(cfg.JWT.RefreshSecret) >= 32, "jwt.refresh_secret: must be at least 32 bytes in release mode")
+    }
+    check(cfg.JWT.AccessTTL > 0, "jwt.access_ttl: must be positive")
+    check(cfg.JWT.RefreshTTL > cfg.JWT.AccessTTL, "jwt.refresh_ttl: must be longer than access_ttl")
+    check(cfg.JWT.MFATTL >= Duration(time.Minute) && cfg.JWT.MFATTL <= Duration(15*time.Minute),
+        "jwt.mfa_ttl: must be between 1m and 15m, got %s", cfg.JWT.MFATTL.Std())
+
+    check(cfg.OTP.Lifetime >= Duration(time.Minute) && cfg.OTP.Lifetime <= Duration(time.Hour),
+        "otp.lifetime: must be between 1m and 1h, got %s", cfg.OTP.Lifetime.Std())
+    check(cfg.OTP.Length >= 4 && cfg.OTP.Length <= 12, "otp.length: must be between 4 and 12, got %d", cfg.OTP.Length)
+    check(cfg.OTP.Alphabet == OTPNumeric || cfg.OTP.Alphabet == OTPAlphanumeric,
+        "otp.alphabet: must be numeric or alphanumeric, got %q", cfg.OTP.Alphabet)
+    check(cfg.OTP.MaxAttempts >= 1 && cfg.OTP.MaxAttempts <= 20, "otp.max_attempts: must be between 1 and 20, got %d", cfg.OTP.MaxAttempts)
+    check(cfg.MFA.MaxAttempts >= 1 && cfg.MFA.MaxAttempts <= 20, "mfa.max_attempts: must be between 1 and 20, got %d", cfg.MFA.MaxAttempts)
+    check(cfg.MFA.Lockout >= Duration(time.Minute) && cfg.MFA.Lockout <= Duration(24*time.Hour),
+        "mfa.lockout: must be between 1m and 24h, got %s", cfg.MFA.Lockout.Std())
+
+    switch cfg.Email.Provider {
+    case "simulation":
+    case "resend":
+        check(cfg.Email.ResendAPIKey != "", "email.resend_api_key: required when email.provider is resend (RESEND_API_KEY)")
+    default:
+        check(false, "email.provider: must be resend or simulation, got %q", cfg.Email.Provider)
+    }
+    check(cfg.Email.From != "", "email.from: required (EMAIL_FROM)")
+
+    check(len(cfg.CORS.AllowedOrigins) > 0, "cors.allowed_origins: at least one origin (or \"*\") is required")
+
+    check(cfg.RateLimit.Backend == "memory" || cfg.RateLimit.Backend == "mongo",
+        "rate_limit.backend: must be memory or mongo, got %q", cfg.RateLimit.Backend)
+    for name, rule := range cfg.RateLimit.Rules {
+        check(rule.Limit > 0 && rule.Window > 0, "rate_limit.rules.%s: limit and window must be positive", name)
+    }
+
+    var level slog.Level
+    check(level.UnmarshalText([]byte(cfg.Log.Level)) == nil, "log.level: must be debug, info, warn or error, got %q", cfg.Log.Level)
+
+    switch cfg.Tracing.Exporter {
+    case "none", "stdout":
+    case "otlp":
+        check(cfg.Tracing.OTLPEndpoint == "" || absoluteURL(cfg.Tracing.OTLPEndpoint),
+            "tracing.otlp_endpoint: %q is not an absolute URL", cfg.Tracing.OTLPEndpoint)
+    default:
+        check(false, "tracing.exporter: must be otlp, stdout or none, got %q", cfg.Tracing.Exporter)
+    }
+    check(cfg.Tracing.ServiceName != "", "tracing.service_name: required (OTEL_SERVICE_NAME)")
+
+    check(cfg.Privacy.MinResponseMS >= 0 && cfg.Privacy.MinResponseMS <= 10000,
+        "privacy.min_response_ms: must be between 0 and 10000, got %d", cfg.Privacy.MinResponseMS)
+
+    check(cfg.Challenge.Mode == ChallengeAdaptive || cfg.Challenge.Mode == ChallengeAlways || cfg.Challenge.Mode == ChallengeOff,
+        "challenge.mode: must be adaptive, always or off, got %q", cfg.Challenge.Mode)
+    check(cfg.Challenge.Threshold > 0, "challenge.threshold: must be positive, got %d", cfg.Challenge.Threshold)
+    check(cfg.Challenge.EmailThreshold > 0, "challenge.email_threshold: must be positive, got %d", cfg.Challenge.EmailThreshold)
+    check(cfg.Challenge.EmailWindow >= Duration(time.Minute) && cfg.Challenge.EmailWindow <= Duration(24*time.Hour),
+        "challenge.email_window: must be between 1m and 24h, got %s", cfg.Challenge.EmailWindow.Std())
+    check(cfg.Challenge.PoWBits >= 1 && cfg.Challenge.PoWBits <= 32, "challenge.pow_bits: must be between 1 and 32, got %d", cfg.Challenge.PoWBits)
+    switch cfg.Challenge.CaptchaProvider {
+    case "":
+    case "turnstile", "hcaptcha", "recaptcha":
+        check(cfg.Challenge.CaptchaSecret != "", "challenge.captcha_secret: required with a CAPTCHA provider (CAPTCHA_SECRET)")
+        check(cfg.Challenge.CaptchaSiteKey != "", "challenge.captcha_site_key: required with a CAPTCHA provider (CAPTCHA_SITE_KEY)")
+    default:
+        check(false, "challenge.captcha_provider: must be turnstile, hcaptcha or recaptcha, got %q", cfg.Challenge.CaptchaProvider)
+    }
+
+    check(cfg.MagicLink.RedirectURL == "" || absoluteURL(cfg.MagicLink.RedirectURL),
+        "magic_link.redirect_url: %q is not an absolute URL", cfg.MagicLink.RedirectURL)
+    check(cfg.MagicLink.BaseURL == "" || absoluteURL(cfg.MagicLink.BaseURL),
+        "magic_link.base_url: %q is not an absolute URL", cfg.MagicLink.BaseURL)
+    check(cfg.MagicLink.RedirectURL == "" || cfg.MagicLink.BaseURL != "",
+        "magic_link.base_url: required when magic links are enabled")
+    check(cfg.MagicLink.ResponseMode == MagicLinkCode || cfg.MagicLink.ResponseMode == MagicLinkTokens,
+        "magic_link.response_mode: must be code or tokens, got %q", cfg.MagicLink.ResponseMode)
+
+    check(cfg.OIDC.Issuer != "", "oidc.issuer: required")
+    check(cfg.OIDC.Issuer == "" || absoluteURL(cfg.OIDC.Issuer), "oidc.issuer: %q is not an absolute URL", cfg.OIDC.Issuer)
+    check(cfg.OIDC.LoginURL == "" || absoluteURL(cfg.OIDC.LoginURL), "oidc.login_url: %q is not an absolute URL", cfg.OIDC.LoginURL)
+    check(cfg.Device.VerificationURL == "" || absoluteURL(cfg.Device.VerificationURL),
+        "device.verification_url: %q is not an absolute URL", cfg.Device.VerificationURL)
+
+    // A guessable shared secret in production is as good as none
+    if cfg.Server.GinMode == "release" {
+        check(cfg.OIDC.RegistrationToken == "" || len(cfg.OIDC.RegistrationToken) >= 32,
+            "oidc.registration_token: must be at least 32 bytes in release mode")
+        check(cfg.Challenge.Secret == "" || len(cfg.Challenge.Secret) >= 32,
+            "challenge.secret: must be at least 32 bytes in release mode")
+    }
+
+    check(cfg.WebAuthn.RPID != "", "webauthn.rp_id: required (WEBAUTHN_RP_ID)")
+    check(len(cfg.WebAuthn.RPOrigins) > 0, "webauthn.rp_origins: at least one origin is required")
+    for _, origin := range cfg.WebAuthn.RPOrigins {
+        check(absoluteURL(origin), "webauthn.rp_origins: %q is not an absolute URL", origin)
+    }
+
+    return errors.Join(errs...)
+}
+
+func absoluteURL(raw string) bool {
+    u, err := url.Parse(raw)
+    return err == nil && u.Scheme != "" && u.Host != ""
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestApplyEnv(t *testing.T) {
+    secretFile := filepath.Join(t.TempDir(), "access_secret")
+    if err := os.WriteFile(secretFile, []byte("from-a-file\n"), 0o600); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name    string
+        env     map[string]string
+        get     func(*Config) interface{}
+        want    interface{}
+        wantErr string
+    }{
+        {
+            name: "string",
+            env:  map[string]string{"DB_NAME": "campus"},
+            get:  func(c *Config) interface{} { return c.Mongo.Database },
+            want: "campus",
+        },
+        {
+            name: "int",
+            env:  map[string]string{"PORT": "9090"},
+            get:  func(c *Config) interface{} { return c.Server.Port },
+            want: 9090,
+        },
+        {
+            name: "bool",
+            env:  map[string]string{"PRIVACY_MODE": "true"},
+            get:  func(c *Config) interface{} { return c.Privacy.Mode },
+            want: true,
+        },
+        {
+            name: "duration",
+            env:  map[string]string{"ACCESS_TOKEN_TTL": "5m"},
+            get:  func(c *Config) interface{} { return c.JWT.AccessTTL },
+            want: Duration(5 * time.Minute),
+        },
+        {
+            name: "list trims spaces and drops empty items",
+            env:  map[string]string{"ADMIN_EMAILS": " a@example.edu, ,b@example.edu,"},
+            get:  func(c *Config) interface{} { return c.Admin.Emails },
+            want: []string{"a@example.edu", "b@example.edu"},
+        },
+        {
+            name: "empty variable keeps the default",
+            env:  map[string]string{"DB_NAME": ""},
+            get:  func(c *Config) interface{} { return c.Mongo.Database },
+            want: "auth_db",
+        },
+        {
+            name: "file variant strips the trailing newline",
+            env:  map[string]string{"ACCESS_SECRET_FILE": secretFile},
+            get:  func(c *Config) interface{} { return c.JWT.AccessSecret },
+            want: "from-a-file",
+        },
+        {
+            name: "file variant wins over the variable",
+            env:  map[string]string{"ACCESS_SECRET": "inline", "ACCESS_SECRET_FILE": secretFile},
+            get:  func(c *Config) interface{} { return c.JWT.AccessSecret },
+            want: "from-a-file",
+        },
+        {
+            name:    "missing file",
+            env:     map[string]string{"ACCESS_SECRET_FILE": filepath.Join(t.TempDir(), "missing")},
+            wantErr: "ACCESS_SECRET_FILE",
+        },
+        {
+            name:    "invalid int",
+            env:     map[string]string{"PORT": "eighty"},
+            wantErr: "PORT",
+        },
+        {
+            name:    "invalid bool",
+            env:     map[string]string{"PRIVACY_MODE": "sometimes"},
+            wantErr: "PRIVACY_MODE",
+        },
+        {
+            name:    "invalid duration",
+            env:     map[string]string{"OTP_LIFETIME": "ten minutes"},
+            wantErr: "OTP_LIFETIME",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for name, value := range tt.env {
+                t.Setenv(name, value)
+            }
+
+            cfg := Default()
+            err := applyEnv(reflect.ValueOf(cfg).Elem())
+
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("applyEnv() error = %v, want it to mention %s", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("applyEnv() error = %v", err)
+            }
+            if got := tt.get(cfg); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("got %#v, want %#v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestApplyEnvReportsEveryError(t *testing.T) {
+    t.Setenv("PORT", "eighty")
+    t.Setenv("MFA_MAX_ATTEMPTS", "many")
+
+    err := applyEnv(reflect.ValueOf(Default()).Elem())
+    if err == nil {
+        t.Fatal("applyEnv() error = nil, want errors for PORT and MFA_MAX_ATTEMPTS")
+    }
+    for _, name := range []string{"PORT", "MFA_MAX_ATTEMPTS"} {
+        if !strings.Contains(err.Error(), name) {
+            t.Errorf("applyEnv() error = %v, want it to mention %s", err, name)
+        }
+    }
+}
+
+func validConfig() *Config {
+    cfg := Default()
+    cfg.Mongo.URI = "mongodb://localhost:27017"
+    cfg.JWT.AccessSecret = strings.Repeat("a", 32)
+    cfg.JWT.RefreshSecret = strings.Repeat("r", 32)
+    cfg.Tracing.Exporter = "none"
+    cfg.OIDC.Issuer = "https://auth.example.edu"
+    return cfg
+}
+
+func TestValidate(t *testing.T) {
+    tests := []struct {
+        name    string
+        modify  func(*Config)
+        wantErr string
+    }{
+        {"defaults with secrets", func(c *Config) {}, ""},
+        {"release mode with long secrets", func(c *Config) { c.Server.GinMode = "release" }, ""},
+        {"trusted proxies", func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.1", "10.1.0.0/16"} }, ""},
+        {"resend with a key", func(c *Config) {
+            c.Email.Provider = "resend"
+            c.Email.ResendAPIKey = "re_123"
+        }, ""},
+        {"magic links with a base url", func(c *Config) {
+            c.MagicLink.RedirectURL = "https://app.example.edu/login"
+            c.MagicLink.BaseURL = "https://auth.example.edu"
+        }, ""},
+        {"captcha with keys", func(c *Config) {
+            c.Challenge.CaptchaProvider = "turnstile"
+            c.Challenge.CaptchaSecret = "secret"
+            c.Challenge.CaptchaSiteKey = "site"
+        }, ""},
+        {"port out of range", func(c *Config) { c.Server.Port = 70000 }, "server.port"},
+        {"unknown gin mode", func(c *Config) { c.Server.GinMode = "prod" }, "server.gin_mode"},
+        {"bad trusted proxy", func(c *Config) { c.Server.TrustedProxies = []string{"proxy.local"} }, "server.trusted_proxies"},
+        {"missing mongo uri", func(c *Config) { c.Mongo.URI = "" }, "mongo.uri"},
+        {"pool sizes reversed", func(c *Config) { c.Mongo.MinPoolSize = 200 }, "pool sizes"},
+        {"missing access secret", func(c *Config) { c.JWT.AccessSecret = "" }, "jwt.access_secret"},
+        {"same secrets", func(c *Config) { c.JWT.RefreshSecret = c.JWT.AccessSecret }, "must differ"},
+        {"short secret in release mode", func(c *Config) {
+            c.Server.GinMode = "release"
+            c.JWT.RefreshSecret = "short"
+        }, "jwt.refresh_secret: must be at least 32 bytes"},
+        {"refresh shorter than access", func(c *Config) { c.JWT.RefreshTTL = Duration(time.Minute) }, "jwt.refresh_ttl"},
+        {"mfa token lifetime too long", func(c *Config) { c.JWT.MFATTL = Duration(time.Hour) }, "jwt.mfa_ttl"},
+        {"otp lifetime too long", func(c *Config) { c.OTP.Lifetime = Duration(2 * time.Hour) }, "otp.lifetime"},
+        {"otp too short", func(c *Config) { c.OTP.Length = 3 }, "otp.length"},
+        {"unknown otp alphabet", func(c *Config) { c.OTP.Alphabet = "hex" }, "otp.alphabet"},
+        {"mfa lockout too short", func(c *Config) { c.MFA.Lockout = Duration(time.Second) }, "mfa.lockout"},
+        {"resend without a key", func(c *Config) { c.Email.Provider = "resend" }, "email.resend_api_key"},
+        {"unknown email provider", func(c *Config) { c.Email.Provider = "smtp" }, "email.provider"},
+        {"no cors origins", func(c *Config) { c.CORS.AllowedOrigins = nil }, "cors.allowed_origins"},
+        {"unknown rate limit backend", func(c *Config) { c.RateLimit.Backend = "redis" }, "rate_limit.backend"},
+        {"empty rate limit rule", func(c *Config) {
+            c.RateLimit.Rules = map[string]RateRule{"login": {Limit: 0, Window: Duration(time.Minute)}}
+        }, "rate_limit.rules.login"},
+        {"unknown log level", func(c *Config) { c.Log.Level = "verbose" }, "log.level"},
+        {"unknown exporter", func(c *Config) { c.Tracing.Exporter = "jaeger" }, "tracing.exporter"},
+        {"relative otlp endpoint", func(c *Config) {
+            c.Tracing.Exporter = "otlp"
+            c.Tracing.OTLPEndpoint = "collector:4318"
+        }, "tracing.otlp_endpoint"},
+        {"unknown challenge mode", func(c *Config) { c.Challenge.Mode = "sometimes" }, "challenge.mode"},
+        {"no per-email threshold", func(c *Config) { c.Challenge.EmailThreshold = 0 }, "challenge.email_threshold"},
+        {"per-email window too long", func(c *Config) { c.Challenge.EmailWindow = Duration(48 * time.Hour) }, "challenge.email_window"},
+        {"too many pow bits", func(c *Config) { c.Challenge.PoWBits = 40 }, "challenge.pow_bits"},
+        {"captcha without a secret", func(c *Config) {
+            c.Challenge.CaptchaProvider = "hcaptcha"
+            c.Challenge.CaptchaSiteKey = "site"
+        }, "challenge.captcha_secret"},
+        {"unknown captcha provider", func(c *Config) { c.Challenge.CaptchaProvider = "friendly" }, "challenge.captcha_provider"},
+        {"relative magic link redirect", func(c *Config) { c.MagicLink.RedirectURL = "/login" }, "magic_link.redirect_url"},
+        {"magic links without a base url", func(c *Config) { c.MagicLink.RedirectURL = "https://app.example.edu/login" }, "magic_link.base_url"},
+        {"unknown magic link mode", func(c *Config) { c.MagicLink.ResponseMode = "cookie" }, "magic_link.response_mode"},
+        {"missing issuer", func(c *Config) { c.OIDC.Issuer = "" }, "oidc.issuer"},
+        {"relative issuer", func(c *Config) { c.OIDC.Issuer = "auth.example.edu" }, "oidc.issuer"},
+        {"short registration token in release mode", func(c *Config) {
+            c.Server.GinMode = "release"
+            c.OIDC.RegistrationToken = "letmein"
+        }, "oidc.registration_token"},
+        {"no webauthn origins", func(c *Config) { c.WebAuthn.RPOrigins = nil }, "webauthn.rp_origins"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cfg := validConfig()
+            tt.modify(cfg)
+
+            err := cfg.Validate()
+            if tt.wantErr == "" {
+                if err != nil {
+                    t.Errorf("Validate() error = %v, want nil", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Errorf("Validate() error = %v, want it to mention %q", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+    cfg := validConfig()
+    cfg.Server.Port = 0
+    cfg.Mongo.URI = ""
+    cfg.OTP.Length = 20
+
+    err := cfg.Validate()
+    if err == nil {
+        t.Fatal("Validate() error = nil, want three problems")
+    }
+    for _, want := range []string{"server.port", "mongo.uri", "otp.length"} {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("Validate() error = %v, want it to mention %s", err, want)
+        }
+    }
+}
@@ -4,42 +4,46 @@ import (
     "context"
     "fmt"
     "log"
-    "os"
     "sync"
     "time"
     "go.mongodb.org/mongo-driver/mongo"
     "go.mongodb.org/mongo-driver/mongo/options"
-    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/event"
+
+    "github.com/Anurag-spec1/goauthenticate/metrics"
+    "github.com/Anurag-spec1/goauthenticate/tracing"
 )
 
 var (
-    DB             *mongo.Database
-    UserCollection *mongo.Collection
-    client         *mongo.Client
-    once           sync.Once
+    DB                          *mongo.Database
+    UserCollection              *mongo.Collection
+    AuditCollection             *mongo.Collection
+    WebAuthnSessionCollection   *mongo.Collection
+    OAuthClientCollection       *mongo.Collection
+    AuthRequestCollection       *mongo.Collection
+    AuthCodeCollection          *mongo.Collection
+    SigningKeyCollection        *mongo.Collection
+    DeviceAuthCollection        *mongo.Collection
+    RevokedTokenCollection      *mongo.Collection
+    RateLimitCollection         *mongo.Collection
+    OTPChallengeCollection      *mongo.Collection
+    RedeemedChallengeCollection *mongo.Collection
+    client                      *mongo.Client
+    once                        sync.Once
 )
 
-func ConnectDB() {
+func ConnectDB(cfg MongoConfig) {
     once.Do(func() {
-        mongoURI := os.Getenv("MONGO_URI")
-        dbName := os.Getenv("DB_NAME")
-
-        if mongoURI == "" {
-            log.Fatal("MONGO_URI environment variable is not set")
-        }
-        if dbName == "" {
-            dbName = "auth_db"
-        }
-
         // Create client with options
         ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
         defer cancel()
 
         clientOptions := options.Client().
-            ApplyURI(mongoURI).
-            SetMaxPoolSize(100).
-            SetMinPoolSize(5).
-            SetMaxConnIdleTime(30 * time.Second)
+            ApplyURI(cfg.URI).
+            SetMaxPoolSize(uint64(cfg.MaxPoolSize)).
+            SetMinPoolSize(uint64(cfg.MinPoolSize)).
+            SetMaxConnIdleTime(30 * time.Second).
+            SetMonitor(chainMonitors(metrics.MongoMonitor(), tracing.MongoMonitor()))
 
         var err error
         client, err = mongo.Connect(ctx, clientOptions)
@@ -55,14 +59,28 @@ func ConnectDB() {
 
         fmt.Println("✅ Connected to MongoDB!")
         
-        DB = client.Database(dbName)
-        UserCollection = DB.Collection("users")
-
-        // Create indexes
-        createIndexes()
+        UseDatabase(client.Database(cfg.Database))
     })
 }
 
+// UseDatabase points DB and the collection handles at db. ConnectDB calls
+// it; tests use it to run against a database of their own.
+func UseDatabase(db *mongo.Database) {
+    DB = db
+    UserCollection = DB.Collection("users")
+    AuditCollection = DB.Collection("audit_events")
+    WebAuthnSessionCollection = DB.Collection("webauthn_sessions")
+    OAuthClientCollection = DB.Collection("oauth_clients")
+    AuthRequestCollection = DB.Collection("oauth_authorization_requests")
+    AuthCodeCollection = DB.Collection("oauth_codes")
+    SigningKeyCollection = DB.Collection("signing_keys")
+    DeviceAuthCollection = DB.Collection("device_authorizations")
+    RevokedTokenCollection = DB.Collection("revoked_tokens")
+    RateLimitCollection = DB.Collection("rate_limits")
+    OTPChallengeCollection = DB.Collection("otp_challenges")
+    RedeemedChallengeCollection = DB.Collection("redeemed_challenges")
+}
+
 func DisconnectDB() {
     if client != nil {
         ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -76,28 +94,31 @@ func DisconnectDB() {
     }
 }
 
-func createIndexes() {
-    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-    defer cancel()
-
-    // Create unique index on email
-    emailIndex := mongo.IndexModel{
-        Keys:    bson.D{{Key: "email", Value: 1}},
-        Options: options.Index().SetUnique(true).SetName("unique_email"),
-    }
-
-    // Create TTL index for OTP expiration
-    ttlIndex := mongo.IndexModel{
-        Keys:    bson.D{{Key: "otp_expires_at", Value: 1}},
-        Options: options.Index().SetExpireAfterSeconds(600).SetName("otp_expiry"), // 10 minutes
-    }
-
-    // Create indexes
-    _, err := UserCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{emailIndex, ttlIndex})
-    if err != nil {
-        log.Printf("Warning: Could not create indexes: %v\n", err)
-    } else {
-        fmt.Println("✅ Database indexes created")
+// chainMonitors fans command events out to several monitors, since the
+// driver only takes one
+func chainMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+    return &event.CommandMonitor{
+        Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+            for _, m := range monitors {
+                if m.Started != nil {
+                    m.Started(ctx, e)
+                }
+            }
+        },
+        Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+            for _, m := range monitors {
+                if m.Succeeded != nil {
+                    m.Succeeded(ctx, e)
+                }
+            }
+        },
+        Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+            for _, m := range monitors {
+                if m.Failed != nil {
+                    m.Failed(ctx, e)
+                }
+            }
+        },
     }
 }
 
@@ -1,21 +0,0 @@
-package config
-
-import (
-	"log"
-	"os"
-
-	"github.com/joho/godotenv"
-)
-
-func LoadEnv() {
-	if os.Getenv("GO_ENV") != "production" {
-		err := godotenv.Load()
-		if err != nil {
-			log.Println("No .env file found, using environment variables")
-		}
-	}
-}
-
-func GetEnv(key string) string {
-	return os.Getenv(key)
-}
@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,14 +15,24 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/Anurag-spec1/goauthenticate/config"
+	"github.com/Anurag-spec1/goauthenticate/metrics"
 	"github.com/Anurag-spec1/goauthenticate/models"
 	"github.com/Anurag-spec1/goauthenticate/services"
 	"github.com/Anurag-spec1/goauthenticate/utils"
 )
 
-func RequestOTP(c *gin.Context) {
+// errAccountSuspended stops suspended users at the end of every login flow
+var errAccountSuspended = errors.New("Account suspended")
+
+func (h *Handler) RequestOTP(c *gin.Context) {
+    start := time.Now()
+    defer h.padResponseTime(c, start)
+    otpConfig := h.cfg.OTP
+
     var req struct {
-        Email string `json:"email" binding:"required,email"`
+        Email     string            `json:"email" binding:"required,email"`
+        MagicLink bool              `json:"magic_link"`
+        Challenge challengeSolution `json:"challenge"`
     }
 
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -53,14 +65,41 @@ func RequestOTP(c *gin.Context) {
         return
     }
 
+    // Under abuse, make the client prove it is worth an email first
+    if !h.checkChallenge(c, req.Email, req.Challenge) {
+        return
+    }
+
     // Generate OTP
-    otp := utils.GenerateOTP()
-    otpExpiresAt := time.Now().Add(10 * time.Minute)
+    otp, err := utils.GenerateOTP(otpConfig)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to generate OTP",
+        })
+        return
+    }
+    otpExpiresAt := time.Now().Add(otpConfig.Lifetime.Std())
+
+    // Optional one-click login link sharing the OTP's expiry. Issuing a new
+    // OTP always replaces the nonce, so older links stop working.
+    magicLinkNonce := ""
+    if req.MagicLink && h.magicLinkEnabled(c) {
+        nonce, err := utils.GenerateSecureToken(16)
+        if err != nil {
+            c.JSON(500, gin.H{
+                "success": false,
+                "error": "Failed to generate login link",
+            })
+            return
+        }
+        magicLinkNonce = nonce
+    }
 
     // Check if user exists
     var user models.User
-    err := config.UserCollection.FindOne(
-        context.Background(),
+    err = config.UserCollection.FindOne(
+        c.Request.Context(),
         bson.M{"email": req.Email},
     ).Decode(&user)
 
@@ -80,13 +119,11 @@ func RequestOTP(c *gin.Context) {
                 CurrentYear:   currentYear,
                 YearNumber:    yearNumber,
                 Batch:         emailInfo.Batch,
-                OTP:           otp,
-                OTPExpiresAt:  otpExpiresAt,
                 IsVerified:    false,
                 CreatedAt:     time.Now(),
             }
             
-            _, err = config.UserCollection.InsertOne(context.Background(), user)
+            _, err = config.UserCollection.InsertOne(c.Request.Context(), user)
             if err != nil {
                 c.JSON(500, gin.H{
                     "success": false,
@@ -101,39 +138,61 @@ func RequestOTP(c *gin.Context) {
             })
             return
         }
-    } else {
-        // Update existing user's OTP
-        update := bson.M{
-            "$set": bson.M{
-                "otp":           otp,
-                "otp_expires_at": otpExpiresAt,
-            },
-        }
-        
-        _, err = config.UserCollection.UpdateOne(
-            context.Background(),
-            bson.M{"email": req.Email},
-            update,
-        )
+    }
+
+    // Replaces any code still pending for this user
+    err = h.otp.Issue(c.Request.Context(), &user, models.OTPPurposeLogin, otp, magicLinkNonce, otpExpiresAt)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to store OTP",
+        })
+        return
+    }
+
+    magicLink := ""
+    if magicLinkNonce != "" {
+        link, err := h.buildMagicLink(user.ID.Hex(), magicLinkNonce, otpExpiresAt)
         if err != nil {
-            c.JSON(500, gin.H{
-                "success": false,
-                "error": "Failed to update OTP",
-            })
-            return
+            slog.ErrorContext(c.Request.Context(), "failed to build magic link", "email", req.Email, "error", err)
         }
+        magicLink = link
+    }
+
+    metrics.OTPRequested.Inc()
+
+    locale := services.ResolveLocale(user.Locale, c.GetHeader("Accept-Language"))
+    sendOTP := func(ctx context.Context) {
+        if err := h.email.SendOTPEmail(ctx, req.Email, otp, locale, magicLink, otpConfig.Lifetime.Std()); err != nil {
+            // Log error but continue; the user can ask for another code
+            slog.ErrorContext(ctx, "OTP email failed", "email", req.Email, "error", err)
+        }
+    }
+
+    // In privacy mode the email goes out after we answer, so how long the
+    // provider takes cannot hint at whether the account already existed
+    if h.privacyModeEnabled(c) {
+        go sendOTP(context.WithoutCancel(c.Request.Context()))
+    } else {
+        sendOTP(c.Request.Context())
+    }
+
+    // Don't confirm anything about the address or hand out the student's
+    // details before they prove they own it
+    if h.privacyModeEnabled(c) {
+        c.JSON(200, gin.H{
+            "success": true,
+            "message": "If this address can receive email, a code has been sent",
+            "email": req.Email,
+        })
+        return
     }
-	
-  emailService := services.NewEmailService()
-if err := emailService.SendOTPEmail(req.Email, otp); err != nil {
-    // Log error but continue (OTP will be in logs)
-    log.Printf("Email sending failed (checking logs for OTP): %v", err)
-}
 
     c.JSON(200, gin.H{
         "success": true,
         "message": "OTP sent successfully",
         "email": req.Email,
+        "magic_link_sent": magicLink != "",
         "data_extracted": gin.H{
             "name":           emailInfo.Name,
             "roll_number":    emailInfo.RollNumber,
@@ -187,10 +246,14 @@ func calculateCurrentYearBasedOn2029(admissionYear string) (string, int) {
     return yearString, yearNumber
 }
 
-func VerifyOTP(c *gin.Context) {
+func (h *Handler) VerifyOTP(c *gin.Context) {
+    start := time.Now()
+    defer h.padResponseTime(c, start)
+    otpConfig := h.cfg.OTP
+
     var req struct {
         Email string `json:"email" binding:"required,email"`
-        OTP   string `json:"otp" binding:"required,min=6,max=6"`
+        OTP   string `json:"otp" binding:"required,max=64"`
     }
 
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -201,15 +264,33 @@ func VerifyOTP(c *gin.Context) {
         return
     }
 
+    code := utils.NormalizeOTP(req.OTP, otpConfig)
+    if code == "" {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
     // Find user by email
     var user models.User
     err := config.UserCollection.FindOne(
-        context.Background(),
+        c.Request.Context(),
         bson.M{"email": req.Email},
     ).Decode(&user)
 
     if err != nil {
         if err == mongo.ErrNoDocuments {
+            metrics.OTPVerifications.WithLabelValues("unknown_user").Inc()
+        }
+        if err == mongo.ErrNoDocuments && h.privacyModeEnabled(c) {
+            // Same answer as a wrong code
+            c.JSON(401, gin.H{
+                "success": false,
+                "error": "Invalid or expired OTP",
+            })
+        } else if err == mongo.ErrNoDocuments {
             c.JSON(404, gin.H{
                 "success": false,
                 "error": "User not found",
@@ -223,65 +304,91 @@ func VerifyOTP(c *gin.Context) {
         return
     }
 
-    // Verify OTP
-    if !utils.IsOTPValid(user.OTP, req.OTP, user.OTPExpiresAt) {
+    // Verify OTP. A match consumes the challenge, and with it any magic link.
+    err = h.otp.Verify(c.Request.Context(), user.ID, models.OTPPurposeLogin, code, otpConfig.MaxAttempts)
+    if errors.Is(err, services.ErrOTPTooManyAttempts) {
+        metrics.OTPVerifications.WithLabelValues("too_many_attempts").Inc()
+        if h.privacyModeEnabled(c) {
+            c.JSON(401, gin.H{
+                "success": false,
+                "error": "Invalid or expired OTP",
+            })
+        } else {
+            c.JSON(429, gin.H{
+                "success": false,
+                "error": "Too many attempts, request a new OTP",
+            })
+        }
+        return
+    }
+    if errors.Is(err, services.ErrOTPInvalid) {
+        metrics.OTPVerifications.WithLabelValues("invalid").Inc()
         c.JSON(401, gin.H{
             "success": false,
             "error": "Invalid or expired OTP",
         })
         return
     }
-
-    // Clear OTP after successful verification
-    update := bson.M{
-        "$set": bson.M{
-            "otp":         "",
-            "is_verified": true,
-        },
-    }
-    
-    _, err = config.UserCollection.UpdateOne(
-        context.Background(),
-        bson.M{"email": req.Email},
-        update,
-    )
     if err != nil {
         c.JSON(500, gin.H{
             "success": false,
-            "error": "Failed to update user",
+            "error": "Database error",
         })
         return
     }
 
-    // Generate JWT tokens
-    accessToken, err := utils.GenerateAccessToken(user.ID.Hex())
-    if err != nil {
-        c.JSON(500, gin.H{
+    metrics.OTPVerifications.WithLabelValues("verified").Inc()
+
+    if !user.Suspended {
+        if err := h.markVerified(c, &user); err != nil {
+            c.JSON(500, gin.H{
+                "success": false,
+                "error": "Failed to update user",
+            })
+            return
+        }
+    }
+
+    h.respondWithLogin(c, &user)
+}
+
+// respondWithLogin finishes a first-factor login. Users with MFA enabled get
+// a short-lived partial token to exchange at /auth/mfa/verify instead of
+// real tokens.
+func (h *Handler) respondWithLogin(c *gin.Context, user *models.User) {
+    if user.Suspended {
+        c.JSON(403, gin.H{
             "success": false,
-            "error": "Failed to generate access token",
+            "error": errAccountSuspended.Error(),
         })
         return
     }
 
-    refreshToken, err := utils.GenerateRefreshToken(user.ID.Hex())
-    if err != nil {
-        c.JSON(500, gin.H{
-            "success": false,
-            "error": "Failed to generate refresh token",
+    if user.MFAEnabled {
+        mfaToken, err := utils.GenerateMFAToken(h.cfg.JWT, user.ID.Hex())
+        if err != nil {
+            c.JSON(500, gin.H{
+                "success": false,
+                "error": "Failed to generate MFA token",
+            })
+            return
+        }
+
+        c.JSON(200, gin.H{
+            "success": true,
+            "message": "Second factor required",
+            "mfa_required": true,
+            "mfa_token":    mfaToken,
+            "mfa_methods":  enabledMFAMethods(user),
         })
         return
     }
 
-    // Store refresh token in database
-    _, err = config.UserCollection.UpdateOne(
-        context.Background(),
-        bson.M{"email": req.Email},
-        bson.M{"$set": bson.M{"refresh_token": refreshToken}},
-    )
+    accessToken, refreshToken, err := h.completeLogin(c, user)
     if err != nil {
-        c.JSON(500, gin.H{
+        c.JSON(loginErrorStatus(err), gin.H{
             "success": false,
-            "error": "Failed to store refresh token",
+            "error": err.Error(),
         })
         return
     }
@@ -291,21 +398,89 @@ func VerifyOTP(c *gin.Context) {
         "message": "Authentication successful",
         "access_token":  accessToken,
         "refresh_token": refreshToken,
-        "user": gin.H{
-            "id":             user.ID.Hex(),
-            "name":           user.Name,
-            "email":          user.Email,
-            "roll_number":    user.RollNumber,
-            "branch":         user.Branch,
-            "admission_year": user.AdmissionYear,
-            "current_year":   user.CurrentYear,
-            "year_number":    user.YearNumber,
-            "batch":          user.Batch,
-        },
+        "user":          userResponse(user),
     })
 }
 
-func Refresh(c *gin.Context) {
+func userResponse(user *models.User) gin.H {
+    return gin.H{
+        "id":             user.ID.Hex(),
+        "name":           user.Name,
+        "email":          user.Email,
+        "roll_number":    user.RollNumber,
+        "branch":         user.Branch,
+        "admission_year": user.AdmissionYear,
+        "current_year":   user.CurrentYear,
+        "year_number":    user.YearNumber,
+        "batch":          user.Batch,
+    }
+}
+
+// markVerified records that the user has proven they own their email (OTP
+// or magic link). The first time, that completes sign-up and they get the
+// welcome email, whether or not a second factor is still to come.
+func (h *Handler) markVerified(c *gin.Context, user *models.User) error {
+    if user.IsVerified {
+        return nil
+    }
+
+    _, err := config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"is_verified": true}},
+    )
+    if err != nil {
+        return err
+    }
+    user.IsVerified = true
+
+    locale := services.ResolveLocale(user.Locale, c.GetHeader("Accept-Language"))
+    if err := h.email.SendWelcomeEmail(c.Request.Context(), user.Email, user.Name, locale); err != nil {
+        slog.ErrorContext(c.Request.Context(), "welcome email failed", "email", user.Email, "error", err)
+    }
+    return nil
+}
+
+// completeLogin runs once the user has passed every factor: it issues and
+// stores a fresh token pair.
+func (h *Handler) completeLogin(c *gin.Context, user *models.User) (string, string, error) {
+    if user.Suspended {
+        return "", "", errAccountSuspended
+    }
+
+    // Generate JWT tokens
+    accessToken, err := utils.GenerateAccessToken(h.cfg.JWT, user.ID.Hex())
+    if err != nil {
+        return "", "", errors.New("Failed to generate access token")
+    }
+
+    refreshToken, err := utils.GenerateRefreshToken(h.cfg.JWT, user.ID.Hex())
+    if err != nil {
+        return "", "", errors.New("Failed to generate refresh token")
+    }
+
+    // Store refresh token in database
+    _, err = config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"refresh_token": refreshToken}},
+    )
+    if err != nil {
+        return "", "", errors.New("Failed to store refresh token")
+    }
+
+    return accessToken, refreshToken, nil
+}
+
+// loginErrorStatus is the HTTP status for an error from completeLogin
+func loginErrorStatus(err error) int {
+    if errors.Is(err, errAccountSuspended) {
+        return 403
+    }
+    return 500
+}
+
+func (h *Handler) Refresh(c *gin.Context) {
     var req struct {
         RefreshToken string `json:"refresh_token" binding:"required"`
     }
@@ -319,7 +494,7 @@ func Refresh(c *gin.Context) {
     }
 
     // Parse and validate refresh token
-    token, err := utils.ParseToken(req.RefreshToken, true)
+    token, err := utils.ParseToken(h.cfg.JWT, req.RefreshToken, true)
     if err != nil || !token.Valid {
         c.JSON(401, gin.H{
             "success": false,
@@ -358,7 +533,7 @@ func Refresh(c *gin.Context) {
 
     var user models.User
     err = config.UserCollection.FindOne(
-        context.Background(),
+        c.Request.Context(),
         bson.M{
             "_id":           objID,
             "refresh_token": req.RefreshToken,
@@ -373,8 +548,16 @@ func Refresh(c *gin.Context) {
         return
     }
 
+    if user.Suspended {
+        c.JSON(403, gin.H{
+            "success": false,
+            "error": errAccountSuspended.Error(),
+        })
+        return
+    }
+
     // Generate new access token
-    newAccessToken, err := utils.GenerateAccessToken(userID)
+    newAccessToken, err := utils.GenerateAccessToken(h.cfg.JWT, userID)
     if err != nil {
         c.JSON(500, gin.H{
             "success": false,
@@ -411,7 +594,7 @@ func GetProfile(c *gin.Context) {
 
     var user models.User
     err = config.UserCollection.FindOne(
-        context.Background(),
+        c.Request.Context(),
         bson.M{"_id": objID},
     ).Decode(&user)
 
@@ -430,7 +613,19 @@ func GetProfile(c *gin.Context) {
         return
     }
 
-    c.JSON(200, gin.H{
+    // Tokens issued to OAuth clients only see what their scopes release,
+    // exactly as at the userinfo endpoint
+    if scope, restricted := c.Get("scope"); restricted {
+        claims := scopedUserClaims(&user, strings.Fields(scope.(string)))
+        claims["id"] = user.ID.Hex()
+        c.JSON(200, gin.H{
+            "success": true,
+            "user": claims,
+        })
+        return
+    }
+
+    response := gin.H{
         "success": true,
         "user": gin.H{
             "id":             user.ID.Hex(),
@@ -442,8 +637,112 @@ func GetProfile(c *gin.Context) {
             "current_year":   user.CurrentYear,
             "year_number":    user.YearNumber,
             "batch":          user.Batch,
+            "locale":         services.ResolveLocale(user.Locale, ""),
             "is_verified":    user.IsVerified,
+            "mfa_enabled":    user.MFAEnabled,
             "created_at":     user.CreatedAt.Format(time.RFC3339),
         },
+    }
+
+    // Make it obvious when support staff are looking through this account
+    if impersonator, ok := c.Get("impersonator"); ok {
+        response["impersonated_by"] = impersonator
+    }
+
+    c.JSON(200, response)
+}
+
+func UpdateLocale(c *gin.Context) {
+    var req struct {
+        Locale string `json:"locale" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    if !services.IsSupportedLocale(req.Locale) {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Unsupported locale",
+            "supported_locales": services.SupportedLocales,
+        })
+        return
+    }
+
+    userID, _ := c.Get("user_id")
+    objID, err := primitive.ObjectIDFromHex(userID.(string))
+    if err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid user ID",
+        })
+        return
+    }
+
+    _, err = config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": objID},
+        bson.M{"$set": bson.M{"locale": req.Locale}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to update locale",
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "locale": req.Locale,
     })
-}
\ No newline at end of file
+}
+// loadCurrentUser fetches the user behind the request's access token,
+// writing the error response itself when it can't
+func loadCurrentUser(c *gin.Context) (*models.User, bool) {
+    userID, exists := c.Get("user_id")
+    if !exists {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "User not authenticated",
+        })
+        return nil, false
+    }
+
+    objID, err := primitive.ObjectIDFromHex(userID.(string))
+    if err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid user ID",
+        })
+        return nil, false
+    }
+
+    var user models.User
+    err = config.UserCollection.FindOne(
+        c.Request.Context(),
+        bson.M{"_id": objID},
+    ).Decode(&user)
+
+    if err != nil {
+        if err == mongo.ErrNoDocuments {
+            c.JSON(404, gin.H{
+                "success": false,
+                "error": "User not found",
+            })
+        } else {
+            c.JSON(500, gin.H{
+                "success": false,
+                "error": "Database error",
+            })
+        }
+        return nil, false
+    }
+
+    return &user, true
+}
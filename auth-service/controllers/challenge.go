@@ -0,0 +1,114 @@
+package controllers
+
+import (
+    "log/slog"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/middleware"
+)
+
+// challengeSolution is the optional "challenge" object on RequestOTP:
+// token and nonce for proof-of-work, or captcha_token
+type challengeSolution struct {
+    Token        string `json:"token"`
+    Nonce        string `json:"nonce"`
+    CaptchaToken string `json:"captcha_token"`
+}
+
+// IssueChallenge hands out a challenge up front, for clients that would
+// rather solve one before calling RequestOTP than after a 428
+func (h *Handler) IssueChallenge(c *gin.Context) {
+    challenge, err := h.newChallenge(c)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to create challenge",
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "challenge": challenge,
+    })
+}
+
+// checkChallenge decides whether an OTP request may go ahead. In the
+// "adaptive" challenge mode (the default) a solved challenge is needed only
+// while overall volume is above the threshold or the same email keeps being
+// asked for; "always" needs one every time and "off" never does. When one
+// is needed and missing it answers 428 with a fresh challenge.
+func (h *Handler) checkChallenge(c *gin.Context, email string, solution challengeSolution) bool {
+    mode := h.cfg.Challenge.Mode
+    if mode == config.ChallengeOff || (mode != config.ChallengeAlways && !h.otpRequestRisky(c, email)) {
+        return true
+    }
+
+    if captcha := h.challenge.Captcha(); captcha != nil {
+        ok, err := captcha.Verify(c.Request.Context(), solution.CaptchaToken, middleware.ClientIP(c))
+        if err != nil {
+            slog.WarnContext(c.Request.Context(), "CAPTCHA verification failed", "provider", captcha.Provider(), "error", err)
+        }
+        if ok {
+            return true
+        }
+    } else if h.challenge.VerifyProofOfWork(c.Request.Context(), solution.Token, email, solution.Nonce) == nil {
+        return true
+    }
+
+    challenge, err := h.newChallenge(c)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to create challenge",
+        })
+        return false
+    }
+
+    c.JSON(428, gin.H{
+        "success": false,
+        "error": "Challenge required",
+        "challenge_required": true,
+        "challenge":          challenge,
+    })
+    return false
+}
+
+// otpRequestRisky counts the request towards the global and per-email
+// volumes and reports whether either is over its threshold
+func (h *Handler) otpRequestRisky(c *gin.Context, email string) bool {
+    ctx := c.Request.Context()
+    global, err := h.otpVolume.Allow(ctx, "all")
+    if err != nil || !global.Allowed {
+        return true
+    }
+    perEmail, err := h.emailOTPVolume.Allow(ctx, strings.ToLower(email))
+    return err != nil || !perEmail.Allowed
+}
+
+// newChallenge describes what the client has to solve: the CAPTCHA widget
+// to render when a provider is configured, otherwise a proof-of-work puzzle
+func (h *Handler) newChallenge(c *gin.Context) (gin.H, error) {
+    if captcha := h.challenge.Captcha(); captcha != nil {
+        return gin.H{
+            "type":     "captcha",
+            "provider": captcha.Provider(),
+            "site_key": captcha.SiteKey(),
+        }, nil
+    }
+
+    pow, err := h.challenge.NewProofOfWork()
+    if err != nil {
+        return nil, err
+    }
+    return gin.H{
+        "type":       "pow",
+        "algorithm":  "sha256",
+        "token":      pow.Token,
+        "difficulty": pow.Bits,
+        "expires_in": pow.ExpiresIn,
+    }, nil
+}
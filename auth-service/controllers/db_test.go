@@ -0,0 +1,176 @@
+package controllers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/ratelimit"
+    "github.com/Anurag-spec1/goauthenticate/services"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// testDB points the collections at a fresh database on the MongoDB at
+// MONGO_TEST_URI and drops it afterwards. Tests that need the database are
+// skipped when the variable is unset. No indexes are created: the flows
+// under test must hold up without them.
+func testDB(t *testing.T) {
+    t.Helper()
+
+    uri := os.Getenv("MONGO_TEST_URI")
+    if uri == "" {
+        t.Skip("MONGO_TEST_URI is not set")
+    }
+
+    ctx := context.Background()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatal(err)
+    }
+    db := client.Database(fmt.Sprintf("goauthenticate_test_%d", time.Now().UnixNano()))
+    t.Cleanup(func() {
+        db.Drop(ctx)
+        client.Disconnect(ctx)
+    })
+
+    config.UseDatabase(db)
+}
+
+// testConfig is a valid configuration that sends email nowhere
+func testConfig() *config.Config {
+    cfg := config.Default()
+    cfg.JWT.AccessSecret = strings.Repeat("a", 32)
+    cfg.JWT.RefreshSecret = strings.Repeat("r", 32)
+    cfg.JWT.MagicLinkSecret = cfg.JWT.AccessSecret
+    cfg.OIDC.Issuer = "https://auth.example.edu"
+    cfg.Email.Provider = "simulation"
+    cfg.Email.From = "auth@example.edu"
+    return cfg
+}
+
+// testHandler builds a Handler the way main does, from cfg
+func testHandler(t *testing.T, cfg *config.Config) *Handler {
+    t.Helper()
+
+    webAuthn, err := services.NewWebAuthnService(cfg.WebAuthn)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return NewHandler(cfg, Services{
+        OTP:       services.NewOTPService(cfg.JWT),
+        Email:     services.NewEmailService(cfg.Email),
+        Templates: services.DefaultEmailTemplates(cfg.Email),
+        Challenge: services.NewChallengeService(cfg.Challenge, cfg.JWT, nil),
+        WebAuthn:  webAuthn,
+
+        OTPVolume:      ratelimit.NewMemoryLimiter(ratelimit.Rate{Limit: cfg.Challenge.Threshold, Window: time.Minute}),
+        EmailOTPVolume: ratelimit.NewMemoryLimiter(ratelimit.Rate{Limit: cfg.Challenge.EmailThreshold, Window: cfg.Challenge.EmailWindow.Std()}),
+    })
+}
+
+// insertUser stores a verified student and returns it
+func insertUser(t *testing.T, modify func(*models.User)) *models.User {
+    t.Helper()
+
+    user := &models.User{
+        ID:         primitive.NewObjectID(),
+        Name:       "Student",
+        Email:      fmt.Sprintf("student.%d@kiet.edu", time.Now().UnixNano()),
+        IsVerified: true,
+        CreatedAt:  time.Now(),
+    }
+    if modify != nil {
+        modify(user)
+    }
+    if _, err := config.UserCollection.InsertOne(context.Background(), user); err != nil {
+        t.Fatal(err)
+    }
+    return user
+}
+
+// insertClient stores an enabled OAuth client. The secret is returned for
+// confidential clients and empty for public ones.
+func insertClient(t *testing.T, modify func(*models.OAuthClient)) (*models.OAuthClient, string) {
+    t.Helper()
+
+    secret := "secret-" + primitive.NewObjectID().Hex()
+    hash, err := utils.HashPassword(secret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    client := &models.OAuthClient{
+        ID:            primitive.NewObjectID(),
+        ClientID:      "client-" + primitive.NewObjectID().Hex(),
+        SecretHash:    hash,
+        Name:          "Test client",
+        AllowedScopes: []string{"openid", "profile", "email"},
+        CreatedAt:     time.Now(),
+        UpdatedAt:     time.Now(),
+    }
+    if modify != nil {
+        modify(client)
+    }
+    if client.Public {
+        client.SecretHash, secret = "", ""
+    }
+    if _, err := config.OAuthClientCollection.InsertOne(context.Background(), client); err != nil {
+        t.Fatal(err)
+    }
+    return client, secret
+}
+
+// serve runs one request through handler and returns the recorded response.
+// A url.Values body is sent as a form, anything else as JSON.
+func serve(handler gin.HandlerFunc, method, target string, body interface{}, setup func(*gin.Context)) *httptest.ResponseRecorder {
+    var req *http.Request
+    switch b := body.(type) {
+    case nil:
+        req = httptest.NewRequest(method, target, nil)
+    case url.Values:
+        req = httptest.NewRequest(method, target, strings.NewReader(b.Encode()))
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    default:
+        data, _ := json.Marshal(b)
+        req = httptest.NewRequest(method, target, bytes.NewReader(data))
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.Handle(method, req.URL.Path, func(c *gin.Context) {
+        if setup != nil {
+            setup(c)
+        }
+        handler(c)
+    })
+
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    return w
+}
+
+// decode unmarshals a JSON response body
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+    t.Helper()
+
+    var body map[string]interface{}
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("response is not JSON: %v\n%s", err, w.Body.String())
+    }
+    return body
+}
@@ -0,0 +1,335 @@
+package controllers
+
+import (
+    "log/slog"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+const (
+    deviceCodeLifetime  = 10 * time.Minute
+    devicePollInterval  = 5
+    deviceSlowDownDelta = 5
+)
+
+// deviceFlowEnabled reports whether there is a page for users to enter
+// device codes on. Without a verification URL the device grant is off.
+func (h *Handler) deviceFlowEnabled(c *gin.Context) bool {
+    return h.cfg.Device.VerificationURL != ""
+}
+
+// DeviceAuthorization starts an RFC 8628 device login. The device shows
+// the user code and verification URI, then polls the token endpoint with
+// the device code.
+func (h *Handler) DeviceAuthorization(c *gin.Context) {
+    if !h.deviceFlowEnabled(c) {
+        oauthError(c, 404, "unsupported_grant_type", "Device authorization is not enabled")
+        return
+    }
+
+    client, ok := authenticateClient(c)
+    if !ok {
+        return
+    }
+
+    if !containsString(client.GrantTypes, models.GrantDeviceCode) {
+        oauthError(c, 400, "unauthorized_client", "This client may not use the device authorization grant")
+        return
+    }
+
+    scopes := strings.Fields(c.PostForm("scope"))
+    for _, scope := range scopes {
+        if !containsString(supportedScopes, scope) || !containsString(client.AllowedScopes, scope) {
+            oauthError(c, 400, "invalid_scope", "Scope not allowed for this client: "+scope)
+            return
+        }
+    }
+
+    deviceCode, err := utils.GenerateSecureToken(32)
+    if err != nil {
+        oauthError(c, 500, "server_error", "Failed to generate device code")
+        return
+    }
+
+    auth := models.DeviceAuthorization{
+        DeviceCodeHash: utils.HashToken(deviceCode),
+        ClientID:       client.ClientID,
+        Scope:          strings.Join(scopes, " "),
+        Status:         models.DeviceStatusPending,
+        Interval:       devicePollInterval,
+        ExpiresAt:      time.Now().Add(deviceCodeLifetime),
+    }
+
+    // User codes are short, so retry the rare collision with a live one
+    for attempt := 0; ; attempt++ {
+        auth.UserCode, err = utils.GenerateUserCode()
+        if err == nil {
+            _, err = config.DeviceAuthCollection.InsertOne(c.Request.Context(), auth)
+        }
+        if err == nil {
+            break
+        }
+        if !mongo.IsDuplicateKeyError(err) || attempt == 2 {
+            oauthError(c, 500, "server_error", "Failed to create device authorization")
+            return
+        }
+    }
+
+    verificationURI := h.cfg.Device.VerificationURL
+    complete, err := url.Parse(verificationURI)
+    if err != nil {
+        oauthError(c, 500, "server_error", "Invalid device verification URL")
+        return
+    }
+    q := complete.Query()
+    q.Set("user_code", auth.UserCode)
+    complete.RawQuery = q.Encode()
+
+    c.Header("Cache-Control", "no-store")
+    c.JSON(200, gin.H{
+        "device_code":               deviceCode,
+        "user_code":                 auth.UserCode,
+        "verification_uri":          verificationURI,
+        "verification_uri_complete": complete.String(),
+        "expires_in":                int(deviceCodeLifetime.Seconds()),
+        "interval":                  auth.Interval,
+    })
+}
+
+// GetDeviceAuthorization describes a pending device login so the
+// verification page can show which app is asking before the user approves
+func GetDeviceAuthorization(c *gin.Context) {
+    auth, client, ok := findPendingDeviceAuthorization(c, c.Query("user_code"))
+    if !ok {
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "user_code":   auth.UserCode,
+        "client_name": client.Name,
+        "scopes":      strings.Fields(auth.Scope),
+    })
+}
+
+// ApproveDeviceAuthorization records the signed-in user's answer for a
+// user code. The device picks it up on its next poll.
+func ApproveDeviceAuthorization(c *gin.Context) {
+    var body struct {
+        UserCode string `json:"user_code" binding:"required"`
+        Approve  bool   `json:"approve"`
+    }
+
+    if err := c.ShouldBindJSON(&body); err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    status := models.DeviceStatusDenied
+    if body.Approve {
+        status = models.DeviceStatusApproved
+    }
+
+    // Matching on the pending status means a code can only be answered once
+    result, err := config.DeviceAuthCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{
+            "user_code":  utils.NormalizeUserCode(body.UserCode),
+            "status":     models.DeviceStatusPending,
+            "expires_at": bson.M{"$gt": time.Now()},
+        },
+        bson.M{"$set": bson.M{
+            "status":    status,
+            "user_id":   user.ID,
+            "auth_time": time.Now(),
+        }},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Database error",
+        })
+        return
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Invalid or expired code",
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "status": status,
+    })
+}
+
+// tokenFromDeviceCode answers a device's poll. Polling faster than the
+// interval gets slow_down and a longer interval; once the user has
+// answered, the authorization is deleted so the tokens are issued once.
+func (h *Handler) tokenFromDeviceCode(c *gin.Context) {
+    client, ok := authenticateClient(c)
+    if !ok {
+        return
+    }
+
+    if !containsString(client.GrantTypes, models.GrantDeviceCode) {
+        oauthError(c, 400, "unauthorized_client", "This client may not use the device authorization grant")
+        return
+    }
+
+    hash := utils.HashToken(c.PostForm("device_code"))
+
+    var auth models.DeviceAuthorization
+    err := config.DeviceAuthCollection.FindOne(c.Request.Context(), bson.M{"_id": hash}).Decode(&auth)
+    if err != nil || time.Now().After(auth.ExpiresAt) {
+        oauthError(c, 400, "expired_token", "The device code has expired")
+        return
+    }
+    if auth.ClientID != client.ClientID {
+        oauthError(c, 400, "invalid_grant", "Device code was issued to another client")
+        return
+    }
+
+    // Record this poll. Polling again within the interval, or losing the
+    // race to a concurrent poll, counts as too fast.
+    now := time.Now()
+    tooFast := now.Sub(auth.LastPolledAt) < time.Duration(auth.Interval)*time.Second
+    if !tooFast {
+        result, err := config.DeviceAuthCollection.UpdateOne(
+            c.Request.Context(),
+            bson.M{"_id": hash, "last_polled_at": auth.LastPolledAt},
+            bson.M{"$set": bson.M{"last_polled_at": now}},
+        )
+        if err != nil {
+            oauthError(c, 500, "server_error", "Database error")
+            return
+        }
+        tooFast = result.MatchedCount == 0
+    }
+    if tooFast {
+        _, err := config.DeviceAuthCollection.UpdateOne(
+            c.Request.Context(),
+            bson.M{"_id": hash},
+            bson.M{
+                "$inc": bson.M{"interval": deviceSlowDownDelta},
+                "$set": bson.M{"last_polled_at": now},
+            },
+        )
+        if err != nil {
+            oauthError(c, 500, "server_error", "Database error")
+            return
+        }
+        oauthError(c, 400, "slow_down", "Polling too frequently")
+        return
+    }
+
+    switch auth.Status {
+    case models.DeviceStatusPending:
+        oauthError(c, 400, "authorization_pending", "The user has not answered yet")
+        return
+    case models.DeviceStatusDenied:
+        // The denial stands either way; the record expires on its own
+        if _, err := config.DeviceAuthCollection.DeleteOne(c.Request.Context(), bson.M{"_id": hash}); err != nil {
+            slog.ErrorContext(c.Request.Context(), "failed to delete denied device authorization", "client_id", client.ClientID, "error", err)
+        }
+        oauthError(c, 400, "access_denied", "The user denied the request")
+        return
+    }
+
+    // Approved: take it so a second poll cannot get another set of tokens
+    err = config.DeviceAuthCollection.FindOneAndDelete(
+        c.Request.Context(),
+        bson.M{"_id": hash, "status": models.DeviceStatusApproved},
+    ).Decode(&auth)
+    if err != nil {
+        oauthError(c, 400, "invalid_grant", "The device code has already been used")
+        return
+    }
+
+    var user models.User
+    err = config.UserCollection.FindOne(c.Request.Context(), bson.M{"_id": auth.UserID}).Decode(&user)
+    if err != nil {
+        oauthError(c, 400, "invalid_grant", "User no longer exists")
+        return
+    }
+    if user.Suspended {
+        oauthError(c, 400, "invalid_grant", errAccountSuspended.Error())
+        return
+    }
+
+    accessTTL := clientTokenTTL(client.AccessTokenTTL, oidcAccessTokenTTL)
+    accessToken, err := utils.GenerateClientAccessToken(h.cfg.JWT, user.ID.Hex(), client.ClientID, auth.Scope, accessTTL)
+    if err != nil {
+        oauthError(c, 500, "server_error", "Failed to generate access token")
+        return
+    }
+
+    response := gin.H{
+        "access_token": accessToken,
+        "token_type":   "Bearer",
+        "expires_in":   int(accessTTL.Seconds()),
+        "scope":        auth.Scope,
+    }
+
+    if containsString(strings.Fields(auth.Scope), "openid") {
+        idToken, err := h.signIDToken(c, client, &user, auth.Scope, "", auth.AuthTime, accessToken)
+        if err != nil {
+            oauthError(c, 500, "server_error", "Failed to sign ID token")
+            return
+        }
+        response["id_token"] = idToken
+    }
+
+    c.JSON(200, response)
+}
+
+// findPendingDeviceAuthorization loads the live, unanswered authorization
+// for a user code along with its client, writing a 404 if there is none
+func findPendingDeviceAuthorization(c *gin.Context, userCode string) (*models.DeviceAuthorization, *models.OAuthClient, bool) {
+    var auth models.DeviceAuthorization
+    err := config.DeviceAuthCollection.FindOne(
+        c.Request.Context(),
+        bson.M{
+            "user_code":  utils.NormalizeUserCode(userCode),
+            "status":     models.DeviceStatusPending,
+            "expires_at": bson.M{"$gt": time.Now()},
+        },
+    ).Decode(&auth)
+    if err != nil {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Invalid or expired code",
+        })
+        return nil, nil, false
+    }
+
+    client, err := findOAuthClient(c.Request.Context(), auth.ClientID)
+    if err != nil {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Client no longer exists",
+        })
+        return nil, nil, false
+    }
+
+    return &auth, client, true
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+    "context"
+    "net/url"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// insertDeviceAuthorization stores a device authorization for client that
+// was last polled long enough ago to be polled again, and returns its
+// device code
+func insertDeviceAuthorization(t *testing.T, client *models.OAuthClient, status string, userID primitive.ObjectID) string {
+    t.Helper()
+
+    code := "device-" + primitive.NewObjectID().Hex()
+    _, err := config.DeviceAuthCollection.InsertOne(context.Background(), models.DeviceAuthorization{
+        DeviceCodeHash: utils.HashToken(code),
+        UserCode:       primitive.NewObjectID().Hex()[:8],
+        ClientID:       client.ClientID,
+        Scope:          "profile",
+        Status:         status,
+        UserID:         userID,
+        AuthTime:       time.Now(),
+        Interval:       devicePollInterval,
+        LastPolledAt:   time.Now().Add(-time.Minute),
+        ExpiresAt:      time.Now().Add(10 * time.Minute),
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return code
+}
+
+func TestDeviceCodePolling(t *testing.T) {
+    testDB(t)
+
+    h := testHandler(t, testConfig())
+    client, secret := insertClient(t, func(cl *models.OAuthClient) {
+        cl.GrantTypes = []string{models.GrantDeviceCode}
+    })
+
+    poll := func(clientID, clientSecret, deviceCode string) (int, map[string]interface{}) {
+        w := serve(h.Token, "POST", "/oauth/token", url.Values{
+            "grant_type":    {models.GrantDeviceCode},
+            "client_id":     {clientID},
+            "client_secret": {clientSecret},
+            "device_code":   {deviceCode},
+        }, nil)
+        return w.Code, decode(t, w)
+    }
+
+    // allowPoll moves the last poll back so the next one is on time
+    allowPoll := func(t *testing.T, deviceCode string) {
+        t.Helper()
+        _, err := config.DeviceAuthCollection.UpdateOne(context.Background(),
+            bson.M{"_id": utils.HashToken(deviceCode)},
+            bson.M{"$set": bson.M{"last_polled_at": time.Now().Add(-time.Minute)}},
+        )
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    t.Run("pending until the user answers", func(t *testing.T) {
+        code := insertDeviceAuthorization(t, client, models.DeviceStatusPending, primitive.NilObjectID)
+
+        status, body := poll(client.ClientID, secret, code)
+        if status != 400 || body["error"] != "authorization_pending" {
+            t.Errorf("poll = %d %v, want 400 authorization_pending", status, body["error"])
+        }
+    })
+
+    t.Run("polling within the interval slows the client down", func(t *testing.T) {
+        code := insertDeviceAuthorization(t, client, models.DeviceStatusPending, primitive.NilObjectID)
+
+        if _, body := poll(client.ClientID, secret, code); body["error"] != "authorization_pending" {
+            t.Fatalf("first poll error = %v, want authorization_pending", body["error"])
+        }
+        status, body := poll(client.ClientID, secret, code)
+        if status != 400 || body["error"] != "slow_down" {
+            t.Fatalf("early poll = %d %v, want 400 slow_down", status, body["error"])
+        }
+
+        var auth models.DeviceAuthorization
+        err := config.DeviceAuthCollection.FindOne(context.Background(), bson.M{"_id": utils.HashToken(code)}).Decode(&auth)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if want := devicePollInterval + deviceSlowDownDelta; auth.Interval != want {
+            t.Errorf("interval after slow_down = %d, want %d", auth.Interval, want)
+        }
+
+        // The slow_down restarts the clock, so polling straight away again
+        // is still too fast
+        if _, body := poll(client.ClientID, secret, code); body["error"] != "slow_down" {
+            t.Errorf("poll right after slow_down error = %v, want slow_down", body["error"])
+        }
+    })
+
+    t.Run("an approved code issues tokens once", func(t *testing.T) {
+        user := insertUser(t, nil)
+        code := insertDeviceAuthorization(t, client, models.DeviceStatusApproved, user.ID)
+
+        status, body := poll(client.ClientID, secret, code)
+        if status != 200 || body["access_token"] == nil {
+            t.Fatalf("poll = %d %v, want 200 with an access token", status, body)
+        }
+
+        allowPoll(t, code)
+        status, body = poll(client.ClientID, secret, code)
+        if status != 400 || body["error"] != "expired_token" {
+            t.Errorf("second poll = %d %v, want 400 expired_token", status, body["error"])
+        }
+    })
+
+    t.Run("a denied code is refused", func(t *testing.T) {
+        code := insertDeviceAuthorization(t, client, models.DeviceStatusDenied, primitive.NilObjectID)
+
+        status, body := poll(client.ClientID, secret, code)
+        if status != 400 || body["error"] != "access_denied" {
+            t.Errorf("poll = %d %v, want 400 access_denied", status, body["error"])
+        }
+    })
+
+    t.Run("a suspended user gets no tokens", func(t *testing.T) {
+        user := insertUser(t, func(u *models.User) { u.Suspended = true })
+        code := insertDeviceAuthorization(t, client, models.DeviceStatusApproved, user.ID)
+
+        status, body := poll(client.ClientID, secret, code)
+        if status != 400 || body["error"] != "invalid_grant" {
+            t.Errorf("poll = %d %v, want 400 invalid_grant", status, body["error"])
+        }
+    })
+
+    t.Run("another client cannot redeem the code", func(t *testing.T) {
+        other, otherSecret := insertClient(t, func(cl *models.OAuthClient) {
+            cl.GrantTypes = []string{models.GrantDeviceCode}
+        })
+        user := insertUser(t, nil)
+        code := insertDeviceAuthorization(t, client, models.DeviceStatusApproved, user.ID)
+
+        status, body := poll(other.ClientID, otherSecret, code)
+        if status != 400 || body["error"] != "invalid_grant" {
+            t.Fatalf("poll by another client = %d %v, want 400 invalid_grant", status, body["error"])
+        }
+
+        // The owner can still redeem it
+        if status, body := poll(client.ClientID, secret, code); status != 200 {
+            t.Errorf("poll by the owner = %d %v, want 200", status, body)
+        }
+    })
+
+    t.Run("the client must be allowed the grant", func(t *testing.T) {
+        other, otherSecret := insertClient(t, nil)
+        code := insertDeviceAuthorization(t, other, models.DeviceStatusPending, primitive.NilObjectID)
+
+        status, body := poll(other.ClientID, otherSecret, code)
+        if status != 400 || body["error"] != "unauthorized_client" {
+            t.Errorf("poll = %d %v, want 400 unauthorized_client", status, body["error"])
+        }
+    })
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/ratelimit"
+    "github.com/Anurag-spec1/goauthenticate/services"
+)
+
+// Services are the long-lived services the handlers share. main builds
+// them once from their config sections.
+type Services struct {
+    OTP       *services.OTPService
+    Email     *services.EmailService
+    Templates *services.EmailTemplates
+    Challenge *services.ChallengeService
+    WebAuthn  *services.WebAuthnService
+
+    // OTP request volume, overall and per email, above which adaptive
+    // challenges kick in
+    OTPVolume      ratelimit.Limiter
+    EmailOTPVolume ratelimit.Limiter
+}
+
+// Handler holds what the HTTP handlers need beyond the request: the
+// configuration and the shared services
+type Handler struct {
+    cfg       *config.Config
+    otp       *services.OTPService
+    email     *services.EmailService
+    templates *services.EmailTemplates
+    challenge *services.ChallengeService
+    webauthn  *services.WebAuthnService
+
+    otpVolume      ratelimit.Limiter
+    emailOTPVolume ratelimit.Limiter
+}
+
+func NewHandler(cfg *config.Config, svc Services) *Handler {
+    return &Handler{
+        cfg:       cfg,
+        otp:       svc.OTP,
+        email:     svc.Email,
+        templates: svc.Templates,
+        challenge: svc.Challenge,
+        webauthn:  svc.WebAuthn,
+
+        otpVolume:      svc.OTPVolume,
+        emailOTPVolume: svc.EmailOTPVolume,
+    }
+}
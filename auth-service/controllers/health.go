@@ -0,0 +1,83 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "sync/atomic"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+const readinessTimeout = 2 * time.Second
+
+var draining atomic.Bool
+
+// StartDraining makes /readyz fail from now on, so load balancers stop
+// sending traffic while in-flight requests finish
+func StartDraining() {
+    draining.Store(true)
+}
+
+// Livez only says the process is up and serving; it never checks
+// dependencies, so a database outage doesn't get every instance restarted
+func Livez(c *gin.Context) {
+    c.JSON(200, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether this instance should receive traffic: not
+// shutting down, MongoDB answering and email delivery configured. Each
+// dependency's status and latency is listed so a failing probe explains
+// itself.
+func (h *Handler) Readyz(c *gin.Context) {
+    if draining.Load() {
+        c.JSON(503, gin.H{"status": "draining"})
+        return
+    }
+
+    checks := gin.H{
+        "mongo": runCheck(func() (string, error) {
+            client := config.GetClient()
+            if client == nil {
+                return "", errors.New("not connected")
+            }
+            ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+            defer cancel()
+            return "", client.Ping(ctx, nil)
+        }),
+        "email": runCheck(func() (string, error) {
+            return h.email.CheckConfig()
+        }),
+    }
+
+    status, code := "ok", 200
+    for _, check := range checks {
+        if check.(gin.H)["status"] != "ok" {
+            status, code = "unavailable", 503
+        }
+    }
+
+    c.JSON(code, gin.H{
+        "status": status,
+        "checks": checks,
+    })
+}
+
+func runCheck(check func() (string, error)) gin.H {
+    start := time.Now()
+    detail, err := check()
+    result := gin.H{
+        "status":     "ok",
+        "latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+    }
+    if detail != "" {
+        result["detail"] = detail
+    }
+    if err != nil {
+        result["status"] = "error"
+        result["error"] = err.Error()
+    }
+    return result
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+    "log/slog"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/services"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+const impersonationTokenTTL = 10 * time.Minute
+
+// ImpersonateUser gives an admin a short-lived, read-only token for a
+// student so support can see what they see. Other admins cannot be
+// impersonated, there is no refresh token, and every use is audited
+// against the target user with the admin and reason attached.
+func (h *Handler) ImpersonateUser(c *gin.Context) {
+    var req struct {
+        Reason string `json:"reason" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "A reason is required",
+        })
+        return
+    }
+
+    targetID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid user ID",
+        })
+        return
+    }
+
+    var target models.User
+    err = config.UserCollection.FindOne(c.Request.Context(), bson.M{"_id": targetID}).Decode(&target)
+    if err != nil {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "User not found",
+        })
+        return
+    }
+
+    if services.IsAdmin(h.cfg.Admin, &target) {
+        c.JSON(403, gin.H{
+            "success": false,
+            "error": "Admins cannot be impersonated",
+        })
+        return
+    }
+
+    admin := currentUserObjectID(c)
+    token, jti, err := utils.GenerateImpersonationToken(h.cfg.JWT, target.ID.Hex(), admin.Hex(), impersonationTokenTTL)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to generate token",
+        })
+        return
+    }
+
+    expiresAt := time.Now().Add(impersonationTokenTTL)
+    recordAudit(c, models.AuditImpersonationStarted, target.ID, gin.H{
+        "impersonator_id": admin.Hex(),
+        "reason":          req.Reason,
+        "token_id":        jti,
+        "expires_at":      expiresAt,
+    })
+    slog.WarnContext(c.Request.Context(), "admin impersonating user", "admin_id", admin.Hex(), "target", target.Email, "reason", req.Reason)
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "access_token": token,
+        "expires_in":   int(impersonationTokenTTL.Seconds()),
+        "user":         userResponse(&target),
+    })
+}
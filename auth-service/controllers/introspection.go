@@ -0,0 +1,190 @@
+package controllers
+
+import (
+    "context"
+    "log/slog"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/services"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// RFC 7662 token_type values
+const (
+    tokenTypeAccess  = "access_token"
+    tokenTypeRefresh = "refresh_token"
+)
+
+// Introspect implements RFC 7662 for resource servers that cannot verify
+// our tokens themselves. Only confidential clients may call it. Anything
+// that is malformed, expired, revoked or no longer the user's current
+// refresh token is reported as {"active": false} and nothing else.
+func (h *Handler) Introspect(c *gin.Context) {
+    c.Header("Cache-Control", "no-store")
+
+    client, ok := authenticateClient(c)
+    if !ok {
+        return
+    }
+    if client.Public {
+        oauthError(c, 401, "invalid_client", "Public clients cannot introspect tokens")
+        return
+    }
+
+    claims, tokenType, active := inspectToken(c.Request.Context(), h.cfg.JWT, c.PostForm("token"), c.PostForm("token_type_hint"))
+    if !active {
+        c.JSON(200, gin.H{"active": false})
+        return
+    }
+
+    response := gin.H{
+        "active":     true,
+        "token_type": tokenType,
+        "iss":        h.oidcIssuer(),
+    }
+    for _, claim := range []string{"exp", "iat", "jti", "client_id", "scope", "subject_type", "aud", "act", "impersonator"} {
+        if v, ok := claims[claim]; ok {
+            response[claim] = v
+        }
+    }
+    if userID, ok := claims["user_id"].(string); ok {
+        response["sub"] = userID
+    } else if sub, ok := claims["sub"].(string); ok {
+        response["sub"] = sub
+    }
+
+    c.JSON(200, response)
+}
+
+// Revoke implements RFC 7009. A client can revoke the tokens issued to it;
+// unknown or already invalid tokens are accepted silently, as the RFC asks.
+func (h *Handler) Revoke(c *gin.Context) {
+    c.Header("Cache-Control", "no-store")
+
+    client, ok := authenticateClient(c)
+    if !ok {
+        return
+    }
+
+    claims, tokenType, active := inspectToken(c.Request.Context(), h.cfg.JWT, c.PostForm("token"), c.PostForm("token_type_hint"))
+    if !active {
+        c.Status(200)
+        return
+    }
+
+    if owner, _ := claims["client_id"].(string); owner != client.ClientID {
+        oauthError(c, 400, "unauthorized_client", "The token was not issued to this client")
+        return
+    }
+
+    if err := revokeToken(c.Request.Context(), h.cfg.JWT, c.PostForm("token"), claims, tokenType, client.ClientID, "revoked_by_client"); err != nil {
+        slog.ErrorContext(c.Request.Context(), "failed to revoke token", "client_id", client.ClientID, "error", err)
+        oauthError(c, 503, "temporarily_unavailable", "Could not revoke the token, try again")
+        return
+    }
+
+    c.Status(200)
+}
+
+// inspectToken works out whether raw is one of our access or refresh
+// tokens and whether it is still active. The hint only decides which kind
+// is tried first.
+func inspectToken(ctx context.Context, jwtCfg config.JWTConfig, raw, hint string) (jwt.MapClaims, string, bool) {
+    if raw == "" {
+        return nil, "", false
+    }
+
+    order := []bool{false, true}
+    if hint == tokenTypeRefresh {
+        order = []bool{true, false}
+    }
+
+    for _, isRefresh := range order {
+        parsed, err := utils.ParseToken(jwtCfg, raw, isRefresh)
+        if err != nil || !parsed.Valid {
+            continue
+        }
+        claims, ok := parsed.Claims.(jwt.MapClaims)
+        if !ok {
+            continue
+        }
+
+        // Magic link and MFA tokens share the access secret but are not
+        // access tokens
+        tokenType := tokenTypeAccess
+        if isRefresh {
+            tokenType = tokenTypeRefresh
+        }
+        if (isRefresh && claims["type"] != "refresh") || (!isRefresh && claims["type"] != "access") {
+            continue
+        }
+
+        if jti, ok := claims["jti"].(string); ok {
+            revoked, err := services.NewRevocationService().IsRevoked(ctx, jti)
+            if err != nil || revoked {
+                return nil, "", false
+            }
+        }
+
+        // A refresh token is only live while it is the user's current one
+        if isRefresh && !isCurrentRefreshToken(ctx, claims, raw) {
+            return nil, "", false
+        }
+
+        return claims, tokenType, true
+    }
+
+    return nil, "", false
+}
+
+// revokeToken denylists a token by its jti and, for refresh tokens, ends
+// the session it belongs to
+func revokeToken(ctx context.Context, jwtCfg config.JWTConfig, raw string, claims jwt.MapClaims, tokenType, clientID, reason string) error {
+    if jti, ok := claims["jti"].(string); ok {
+        // Without an exp, block it for as long as a token of its kind can live
+        expiresAt := time.Now().Add(utils.TokenTTL(jwtCfg, tokenType == tokenTypeRefresh))
+        if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+            expiresAt = exp.Time
+        }
+        if err := services.NewRevocationService().Revoke(ctx, jti, clientID, reason, expiresAt); err != nil {
+            return err
+        }
+    }
+
+    // Only unset the stored token if it is still this one, so a newer
+    // session is left alone
+    if tokenType == tokenTypeRefresh {
+        userID, _ := claims["user_id"].(string)
+        objID, err := primitive.ObjectIDFromHex(userID)
+        if err != nil {
+            return nil
+        }
+        _, err = config.UserCollection.UpdateOne(
+            ctx,
+            bson.M{"_id": objID, "refresh_token": raw},
+            bson.M{"$unset": bson.M{"refresh_token": ""}},
+        )
+        return err
+    }
+    return nil
+}
+
+func isCurrentRefreshToken(ctx context.Context, claims jwt.MapClaims, raw string) bool {
+    userID, _ := claims["user_id"].(string)
+    objID, err := primitive.ObjectIDFromHex(userID)
+    if err != nil {
+        return false
+    }
+
+    count, err := config.UserCollection.CountDocuments(
+        ctx,
+        bson.M{"_id": objID, "refresh_token": raw},
+    )
+    return err == nil && count > 0
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+    "context"
+    "net/url"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+func TestIntrospectAndRevoke(t *testing.T) {
+    testDB(t)
+
+    cfg := testConfig()
+    h := testHandler(t, cfg)
+    client, secret := insertClient(t, nil)
+
+    send := func(handler gin.HandlerFunc, target, clientID, clientSecret, token string) (int, map[string]interface{}) {
+        w := serve(handler, "POST", target, url.Values{
+            "client_id":     {clientID},
+            "client_secret": {clientSecret},
+            "token":         {token},
+        }, nil)
+        if w.Body.Len() == 0 {
+            return w.Code, nil
+        }
+        return w.Code, decode(t, w)
+    }
+    introspect := func(clientID, clientSecret, token string) (int, map[string]interface{}) {
+        return send(h.Introspect, "/oauth/introspect", clientID, clientSecret, token)
+    }
+    revoke := func(clientID, clientSecret, token string) (int, map[string]interface{}) {
+        return send(h.Revoke, "/oauth/revoke", clientID, clientSecret, token)
+    }
+
+    accessToken := func(t *testing.T, clientID string) string {
+        t.Helper()
+        user := insertUser(t, nil)
+        token, err := utils.GenerateClientAccessToken(cfg.JWT, user.ID.Hex(), clientID, "openid profile", time.Hour)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return token
+    }
+
+    t.Run("an active access token is described", func(t *testing.T) {
+        status, body := introspect(client.ClientID, secret, accessToken(t, client.ClientID))
+        if status != 200 || body["active"] != true {
+            t.Fatalf("introspect = %d %v, want 200 active", status, body)
+        }
+        if body["client_id"] != client.ClientID || body["iss"] != "https://auth.example.edu" {
+            t.Errorf("introspect client_id = %v, iss = %v", body["client_id"], body["iss"])
+        }
+    })
+
+    t.Run("public clients cannot introspect", func(t *testing.T) {
+        public, _ := insertClient(t, func(cl *models.OAuthClient) { cl.Public = true })
+
+        status, body := introspect(public.ClientID, "", accessToken(t, public.ClientID))
+        if status != 401 || body["error"] != "invalid_client" {
+            t.Errorf("introspect = %d %v, want 401 invalid_client", status, body["error"])
+        }
+    })
+
+    t.Run("a wrong client secret is rejected", func(t *testing.T) {
+        status, body := introspect(client.ClientID, "wrong", accessToken(t, client.ClientID))
+        if status != 401 || body["error"] != "invalid_client" {
+            t.Errorf("introspect = %d %v, want 401 invalid_client", status, body["error"])
+        }
+    })
+
+    t.Run("a client cannot revoke another client's token", func(t *testing.T) {
+        other, otherSecret := insertClient(t, nil)
+        token := accessToken(t, client.ClientID)
+
+        status, body := revoke(other.ClientID, otherSecret, token)
+        if status != 400 || body["error"] != "unauthorized_client" {
+            t.Fatalf("revoke = %d %v, want 400 unauthorized_client", status, body)
+        }
+        if _, body := introspect(client.ClientID, secret, token); body["active"] != true {
+            t.Errorf("token is inactive after a refused revocation")
+        }
+    })
+
+    t.Run("a revoked token is inactive", func(t *testing.T) {
+        token := accessToken(t, client.ClientID)
+
+        if status, body := revoke(client.ClientID, secret, token); status != 200 {
+            t.Fatalf("revoke = %d %v, want 200", status, body)
+        }
+        if _, body := introspect(client.ClientID, secret, token); body["active"] != false || len(body) != 1 {
+            t.Errorf("introspect after revoke = %v, want only active false", body)
+        }
+
+        // Revoking again is accepted silently
+        if status, _ := revoke(client.ClientID, secret, token); status != 200 {
+            t.Errorf("second revoke status = %d, want 200", status)
+        }
+    })
+
+    t.Run("a refresh token is only active while it is current", func(t *testing.T) {
+        user := insertUser(t, nil)
+        old, err := utils.GenerateRefreshToken(cfg.JWT, user.ID.Hex())
+        if err != nil {
+            t.Fatal(err)
+        }
+        setRefreshToken := func(token string) {
+            t.Helper()
+            _, err := config.UserCollection.UpdateOne(context.Background(),
+                bson.M{"_id": user.ID},
+                bson.M{"$set": bson.M{"refresh_token": token}},
+            )
+            if err != nil {
+                t.Fatal(err)
+            }
+        }
+
+        setRefreshToken(old)
+        if _, body := introspect(client.ClientID, secret, old); body["active"] != true || body["token_type"] != tokenTypeRefresh {
+            t.Fatalf("introspect current refresh token = %v, want active refresh_token", body)
+        }
+
+        newer, err := utils.GenerateRefreshToken(cfg.JWT, user.ID.Hex())
+        if err != nil {
+            t.Fatal(err)
+        }
+        setRefreshToken(newer)
+        if _, body := introspect(client.ClientID, secret, old); body["active"] != false {
+            t.Errorf("introspect rotated refresh token = %v, want inactive", body)
+        }
+    })
+
+    t.Run("garbage is inactive", func(t *testing.T) {
+        if _, body := introspect(client.ClientID, secret, "not-a-token"); body["active"] != false {
+            t.Errorf("introspect = %v, want inactive", body)
+        }
+    })
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+    "bytes"
+    "errors"
+    "html/template"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/services"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// How long the one-time code handed to the redirect URL can be exchanged for tokens
+const loginCodeLifetime = 60 * time.Second
+
+// magicLinkEnabled reports whether there is somewhere to send users after
+// they click a login link. Without a redirect URL we only send OTPs.
+func (h *Handler) magicLinkEnabled(c *gin.Context) bool {
+    return h.cfg.MagicLink.RedirectURL != ""
+}
+
+// buildMagicLink returns the URL emailed alongside the OTP. It points back at
+// this service, which asks the user to confirm, then verifies it and
+// forwards the user to the redirect URL. The origin always comes from
+// base_url, never from the request, so a forged Host header cannot send
+// someone else's login link to an attacker's site.
+func (h *Handler) buildMagicLink(userID, nonce string, expiresAt time.Time) (string, error) {
+    token, err := utils.GenerateMagicLinkToken(h.cfg.JWT, userID, nonce, expiresAt)
+    if err != nil {
+        return "", err
+    }
+
+    return strings.TrimRight(h.cfg.MagicLink.BaseURL, "/") + "/auth/magic-link?token=" + url.QueryEscape(token), nil
+}
+
+// magicLinkPage asks the user to confirm before the link is spent. Email
+// scanners and link previews fetch links but don't submit forms, so they
+// can't use up a real user's link.
+var magicLinkPage = template.Must(template.New("magic_link").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Sign in</title>
+</head>
+<body style="font-family: sans-serif; text-align: center; margin-top: 4em;">
+<form method="post" action="/auth/magic-link">
+<input type="hidden" name="token" value="{{.}}">
+<p>Continue to sign in?</p>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// MagicLinkLogin is where login links point. It only checks the link and
+// shows a page that confirms with a POST to ConfirmMagicLink; opening the
+// link does not use it up.
+func (h *Handler) MagicLinkLogin(c *gin.Context) {
+    redirectURL := h.cfg.MagicLink.RedirectURL
+    if redirectURL == "" {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Magic link login is not enabled",
+        })
+        return
+    }
+
+    token := c.Query("token")
+    if _, _, err := utils.ParseMagicLinkToken(h.cfg.JWT, token); err != nil {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"invalid_link"}}, false)
+        return
+    }
+
+    var page bytes.Buffer
+    if err := magicLinkPage.Execute(&page, token); err != nil {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"server_error"}}, false)
+        return
+    }
+
+    c.Header("Cache-Control", "no-store")
+    c.Header("Referrer-Policy", "no-referrer")
+    c.Data(200, "text/html; charset=utf-8", page.Bytes())
+}
+
+// ConfirmMagicLink redeems a login link. It belongs to the same OTP challenge
+// as the emailed code, so it shares its expiry and using either ends both.
+//
+// Depending on the magic link response mode the user lands on the redirect URL with
+// either a short-lived authorization code (default, "code") to exchange via
+// POST /auth/magic-link/exchange, or the tokens themselves in the URL fragment
+// ("tokens").
+func (h *Handler) ConfirmMagicLink(c *gin.Context) {
+    cfg := h.cfg.MagicLink
+    redirectURL := cfg.RedirectURL
+    if redirectURL == "" {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Magic link login is not enabled",
+        })
+        return
+    }
+
+    userID, nonce, err := utils.ParseMagicLinkToken(h.cfg.JWT, c.PostForm("token"))
+    if err != nil {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"invalid_link"}}, false)
+        return
+    }
+
+    objID, err := primitive.ObjectIDFromHex(userID)
+    if err != nil {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"invalid_link"}}, false)
+        return
+    }
+
+    tokensMode := cfg.ResponseMode == config.MagicLinkTokens
+
+    // Redeeming deletes the challenge in the same operation that matches it,
+    // so the link is single-use even if it is clicked twice concurrently
+    err = h.otp.RedeemMagicLink(c.Request.Context(), objID, nonce)
+    if errors.Is(err, services.ErrOTPInvalid) {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"expired_link"}}, false)
+        return
+    }
+    if err != nil {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"server_error"}}, false)
+        return
+    }
+
+    var user models.User
+    err = config.UserCollection.FindOne(c.Request.Context(), bson.M{"_id": objID}).Decode(&user)
+    if err != nil {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"expired_link"}}, false)
+        return
+    }
+
+    if user.Suspended {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"account_suspended"}}, false)
+        return
+    }
+
+    // In code mode the account is only marked verified once the code is
+    // exchanged
+    if tokensMode {
+        if err := h.markVerified(c, &user); err != nil {
+            redirectWithParams(c, redirectURL, url.Values{"error": {"server_error"}}, false)
+            return
+        }
+    }
+
+    if tokensMode && user.MFAEnabled {
+        mfaToken, err := utils.GenerateMFAToken(h.cfg.JWT, user.ID.Hex())
+        if err != nil {
+            redirectWithParams(c, redirectURL, url.Values{"error": {"server_error"}}, false)
+            return
+        }
+
+        redirectWithParams(c, redirectURL, url.Values{
+            "mfa_required": {"true"},
+            "mfa_token":    {mfaToken},
+        }, true)
+        return
+    }
+
+    if tokensMode {
+        accessToken, refreshToken, err := h.completeLogin(c, &user)
+        if err != nil {
+            redirectWithParams(c, redirectURL, url.Values{"error": {"server_error"}}, false)
+            return
+        }
+
+        redirectWithParams(c, redirectURL, url.Values{
+            "access_token":  {accessToken},
+            "refresh_token": {refreshToken},
+            "token_type":    {"Bearer"},
+        }, true)
+        return
+    }
+
+    code, err := utils.GenerateSecureToken(32)
+    if err != nil {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"server_error"}}, false)
+        return
+    }
+
+    _, err = config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{
+            "login_code_hash":       utils.HashToken(code),
+            "login_code_expires_at": time.Now().Add(loginCodeLifetime),
+        }},
+    )
+    if err != nil {
+        redirectWithParams(c, redirectURL, url.Values{"error": {"server_error"}}, false)
+        return
+    }
+
+    redirectWithParams(c, redirectURL, url.Values{"code": {code}}, false)
+}
+
+// ExchangeLoginCode swaps the one-time code from a magic link redirect for tokens
+func (h *Handler) ExchangeLoginCode(c *gin.Context) {
+    var req struct {
+        Code string `json:"code" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    var user models.User
+    err := config.UserCollection.FindOneAndUpdate(
+        c.Request.Context(),
+        bson.M{
+            "login_code_hash":       utils.HashToken(req.Code),
+            "login_code_expires_at": bson.M{"$gt": time.Now()},
+        },
+        bson.M{"$unset": bson.M{"login_code_hash": "", "login_code_expires_at": ""}},
+    ).Decode(&user)
+
+    if err != nil {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid or expired code",
+        })
+        return
+    }
+
+    if !user.Suspended {
+        if err := h.markVerified(c, &user); err != nil {
+            c.JSON(500, gin.H{
+                "success": false,
+                "error": "Failed to update user",
+            })
+            return
+        }
+    }
+
+    h.respondWithLogin(c, &user)
+}
+
+// redirectWithParams sends the browser to base with params added to the
+// query string, or to the fragment when they carry tokens that must not
+// reach the redirect target's server logs.
+func redirectWithParams(c *gin.Context, base string, params url.Values, fragment bool) {
+    u, err := url.Parse(base)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Invalid redirect URL",
+        })
+        return
+    }
+
+    if fragment {
+        u.Fragment = params.Encode()
+    } else {
+        q := u.Query()
+        for k, v := range params {
+            q[k] = v
+        }
+        u.RawQuery = q.Encode()
+    }
+
+    c.Redirect(302, u.String())
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+    "context"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+)
+
+func magicLinkConfig(mode string) *config.Config {
+    cfg := testConfig()
+    cfg.MagicLink.RedirectURL = "https://app.example.edu/login"
+    cfg.MagicLink.BaseURL = "https://auth.example.edu/"
+    cfg.MagicLink.ResponseMode = mode
+    return cfg
+}
+
+// issueMagicLink issues a login OTP with a link for user, as RequestOTP
+// does, and returns the link's token
+func issueMagicLink(t *testing.T, h *Handler, user *models.User, nonce string) string {
+    t.Helper()
+
+    expiresAt := time.Now().Add(10 * time.Minute)
+    if err := h.otp.Issue(context.Background(), user, models.OTPPurposeLogin, "123456", nonce, expiresAt); err != nil {
+        t.Fatal(err)
+    }
+    link, err := h.buildMagicLink(user.ID.Hex(), nonce, expiresAt)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    u, err := url.Parse(link)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return u.Query().Get("token")
+}
+
+// redirectParams returns the query and fragment parameters of a redirect
+func redirectParams(t *testing.T, location string) (url.Values, url.Values) {
+    t.Helper()
+
+    u, err := url.Parse(location)
+    if err != nil {
+        t.Fatal(err)
+    }
+    fragment, _ := url.ParseQuery(u.Fragment)
+    return u.Query(), fragment
+}
+
+func TestBuildMagicLinkUsesBaseURL(t *testing.T) {
+    h := testHandler(t, magicLinkConfig(config.MagicLinkCode))
+
+    link, err := h.buildMagicLink("64b7f0c2a1b2c3d4e5f60718", "nonce", time.Now().Add(time.Minute))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasPrefix(link, "https://auth.example.edu/auth/magic-link?token=") {
+        t.Errorf("buildMagicLink() = %s, want it under the configured base URL", link)
+    }
+}
+
+func TestConfirmMagicLink(t *testing.T) {
+    testDB(t)
+
+    t.Run("code mode redeems once and the code is exchanged once", func(t *testing.T) {
+        h := testHandler(t, magicLinkConfig(config.MagicLinkCode))
+        user := insertUser(t, nil)
+        token := issueMagicLink(t, h, user, "nonce-code")
+
+        w := serve(h.ConfirmMagicLink, "POST", "/auth/magic-link", url.Values{"token": {token}}, nil)
+        if w.Code != 302 {
+            t.Fatalf("first redemption status = %d, want 302", w.Code)
+        }
+        query, _ := redirectParams(t, w.Header().Get("Location"))
+        code := query.Get("code")
+        if code == "" {
+            t.Fatalf("redirect %s carries no code", w.Header().Get("Location"))
+        }
+
+        w = serve(h.ConfirmMagicLink, "POST", "/auth/magic-link", url.Values{"token": {token}}, nil)
+        query, _ = redirectParams(t, w.Header().Get("Location"))
+        if query.Get("error") != "expired_link" {
+            t.Errorf("second redemption redirected to %s, want error=expired_link", w.Header().Get("Location"))
+        }
+
+        w = serve(h.ExchangeLoginCode, "POST", "/auth/magic-link/exchange", map[string]string{"code": code}, nil)
+        if w.Code != 200 || decode(t, w)["access_token"] == nil {
+            t.Fatalf("exchange status = %d, body %s, want tokens", w.Code, w.Body.String())
+        }
+
+        w = serve(h.ExchangeLoginCode, "POST", "/auth/magic-link/exchange", map[string]string{"code": code}, nil)
+        if w.Code != 401 {
+            t.Errorf("second exchange status = %d, want 401", w.Code)
+        }
+    })
+
+    t.Run("tokens mode puts the tokens in the fragment", func(t *testing.T) {
+        h := testHandler(t, magicLinkConfig(config.MagicLinkTokens))
+        user := insertUser(t, nil)
+        token := issueMagicLink(t, h, user, "nonce-tokens")
+
+        w := serve(h.ConfirmMagicLink, "POST", "/auth/magic-link", url.Values{"token": {token}}, nil)
+        query, fragment := redirectParams(t, w.Header().Get("Location"))
+        if fragment.Get("access_token") == "" || query.Get("access_token") != "" {
+            t.Errorf("redirect %s, want the access token in the fragment only", w.Header().Get("Location"))
+        }
+    })
+
+    t.Run("a newer code retires the link", func(t *testing.T) {
+        h := testHandler(t, magicLinkConfig(config.MagicLinkCode))
+        user := insertUser(t, nil)
+        token := issueMagicLink(t, h, user, "nonce-old")
+        issueMagicLink(t, h, user, "nonce-new")
+
+        w := serve(h.ConfirmMagicLink, "POST", "/auth/magic-link", url.Values{"token": {token}}, nil)
+        query, _ := redirectParams(t, w.Header().Get("Location"))
+        if query.Get("error") != "expired_link" {
+            t.Errorf("old link redirected to %s, want error=expired_link", w.Header().Get("Location"))
+        }
+    })
+
+    t.Run("suspended users are turned away", func(t *testing.T) {
+        h := testHandler(t, magicLinkConfig(config.MagicLinkTokens))
+        user := insertUser(t, func(u *models.User) { u.Suspended = true })
+        token := issueMagicLink(t, h, user, "nonce-suspended")
+
+        w := serve(h.ConfirmMagicLink, "POST", "/auth/magic-link", url.Values{"token": {token}}, nil)
+        query, fragment := redirectParams(t, w.Header().Get("Location"))
+        if query.Get("error") != "account_suspended" || fragment.Get("access_token") != "" {
+            t.Errorf("redirect %s, want error=account_suspended and no tokens", w.Header().Get("Location"))
+        }
+    })
+
+    t.Run("tampered token", func(t *testing.T) {
+        h := testHandler(t, magicLinkConfig(config.MagicLinkCode))
+        user := insertUser(t, nil)
+        token := issueMagicLink(t, h, user, "nonce-tampered")
+
+        w := serve(h.ConfirmMagicLink, "POST", "/auth/magic-link", url.Values{"token": {token + "x"}}, nil)
+        query, _ := redirectParams(t, w.Header().Get("Location"))
+        if query.Get("error") != "invalid_link" {
+            t.Errorf("redirect %s, want error=invalid_link", w.Header().Get("Location"))
+        }
+    })
+}
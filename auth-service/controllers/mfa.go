@@ -0,0 +1,582 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/middleware"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/services"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// Number of recovery codes issued at enrollment and on regeneration
+const recoveryCodeCount = 10
+
+var (
+    errSecondFactorInvalid = errors.New("Invalid code")
+    errSecondFactorLocked  = errors.New("Too many failed attempts, try again later")
+)
+
+func GetMFAStatus(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "mfa_enabled": user.MFAEnabled,
+        "methods":     enabledMFAMethods(user),
+        "recovery_codes_remaining": len(user.RecoveryCodes),
+    })
+}
+
+// EnrollTOTP starts authenticator app enrollment. The secret stays pending
+// until ConfirmTOTP proves the user's app produces matching codes.
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if user.MFAEnabled {
+        c.JSON(409, gin.H{
+            "success": false,
+            "error": "Authenticator app is already enabled",
+        })
+        return
+    }
+
+    secret, err := utils.GenerateTOTPSecret()
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to generate secret",
+        })
+        return
+    }
+
+    _, err = config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"totp_pending_secret": secret}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to start enrollment",
+        })
+        return
+    }
+
+    issuer := h.templates.BrandingFor(user.Email).ProductName
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "secret":           secret,
+        "provisioning_uri": utils.TOTPProvisioningURI(secret, user.Email, issuer),
+        "message":          "Scan the provisioning URI as a QR code, then confirm with a code from your app",
+    })
+}
+
+// ConfirmTOTP finishes enrollment and turns MFA on
+func ConfirmTOTP(c *gin.Context) {
+    var req struct {
+        Code string `json:"code" binding:"required"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if user.TOTPPendingSecret == "" {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "No enrollment in progress",
+        })
+        return
+    }
+
+    step, valid := utils.ValidateTOTP(user.TOTPPendingSecret, req.Code, time.Now())
+    if !valid {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid code",
+        })
+        return
+    }
+
+    codes, hashes, err := newRecoveryCodes()
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to generate recovery codes",
+        })
+        return
+    }
+
+    _, err = config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID, "totp_pending_secret": user.TOTPPendingSecret},
+        bson.M{
+            "$set": bson.M{
+                "mfa_enabled":    true,
+                "totp_secret":    user.TOTPPendingSecret,
+                "totp_last_step": step,
+                "recovery_codes": hashes,
+            },
+            "$unset": bson.M{"totp_pending_secret": ""},
+        },
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to enable MFA",
+        })
+        return
+    }
+
+    recordAudit(c, models.AuditMFAEnabled, user.ID, gin.H{"method": "totp"})
+    recordAudit(c, models.AuditRecoveryCodesGenerated, user.ID, gin.H{"count": len(codes)})
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "message": "Authenticator app enabled. Store these recovery codes somewhere safe; they will not be shown again.",
+        "recovery_codes": codes,
+    })
+}
+
+// DisableTOTP turns MFA off. A current code or a recovery code is required
+// so a stolen access token alone can't strip the second factor. Users who
+// lost their authenticator disable it with a recovery code and enroll again.
+func (h *Handler) DisableTOTP(c *gin.Context) {
+    var req struct {
+        Code         string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "") == (req.RecoveryCode == "") {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if !user.MFAEnabled {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "MFA is not enabled",
+        })
+        return
+    }
+
+    if err := h.checkSecondFactor(c, user, req.Code, req.RecoveryCode); err != nil {
+        respondSecondFactorError(c, err)
+        return
+    }
+
+    _, err := config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{
+            "$set":   bson.M{"mfa_enabled": false},
+            "$unset": bson.M{"totp_secret": "", "totp_last_step": "", "recovery_codes": ""},
+        },
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to disable MFA",
+        })
+        return
+    }
+
+    recordAudit(c, models.AuditMFADisabled, user.ID, gin.H{"method": "totp"})
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "message": "Authenticator app disabled",
+    })
+}
+
+// RegenerateRecoveryCodes replaces every existing recovery code with a
+// fresh set. Requires a current authenticator code or one of the old
+// recovery codes.
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+    var req struct {
+        Code         string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "") == (req.RecoveryCode == "") {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if !user.MFAEnabled {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "MFA is not enabled",
+        })
+        return
+    }
+
+    if err := h.checkSecondFactor(c, user, req.Code, req.RecoveryCode); err != nil {
+        respondSecondFactorError(c, err)
+        return
+    }
+
+    codes, hashes, err := newRecoveryCodes()
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to generate recovery codes",
+        })
+        return
+    }
+
+    _, err = config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"recovery_codes": hashes}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to store recovery codes",
+        })
+        return
+    }
+
+    recordAudit(c, models.AuditRecoveryCodesGenerated, user.ID, gin.H{"count": len(codes), "regenerated": true})
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "message": "Previous recovery codes no longer work. Store these somewhere safe; they will not be shown again.",
+        "recovery_codes": codes,
+    })
+}
+
+// VerifyMFA exchanges the partial token from VerifyOTP plus either a TOTP
+// code or a recovery code for real access and refresh tokens
+func (h *Handler) VerifyMFA(c *gin.Context) {
+    var req struct {
+        MFAToken     string `json:"mfa_token" binding:"required"`
+        Code         string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "") == (req.RecoveryCode == "") {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    userID, tokenID, tokenExpiresAt, err := utils.ParseMFAToken(h.cfg.JWT, req.MFAToken)
+    if err != nil {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid or expired MFA token",
+        })
+        return
+    }
+
+    // MFA tokens are single-use and die with a lockout
+    revocations := services.NewRevocationService()
+    revoked, err := revocations.IsRevoked(c.Request.Context(), tokenID)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Database error",
+        })
+        return
+    }
+    if revoked {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid or expired MFA token",
+        })
+        return
+    }
+
+    objID, err := primitive.ObjectIDFromHex(userID)
+    if err != nil {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid user ID format",
+        })
+        return
+    }
+
+    var user models.User
+    err = config.UserCollection.FindOne(
+        c.Request.Context(),
+        bson.M{"_id": objID},
+    ).Decode(&user)
+
+    if err != nil || !user.MFAEnabled {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid or expired MFA token",
+        })
+        return
+    }
+
+    err = h.checkSecondFactor(c, &user, req.Code, req.RecoveryCode)
+    if err == nil || errors.Is(err, errSecondFactorLocked) {
+        if err := revocations.Revoke(c.Request.Context(), tokenID, "", "mfa_token_used", tokenExpiresAt); err != nil {
+            slog.ErrorContext(c.Request.Context(), "failed to revoke MFA token", "user_id", userID, "error", err)
+        }
+    }
+    if err != nil {
+        respondSecondFactorError(c, err)
+        return
+    }
+
+    accessToken, refreshToken, err := h.completeLogin(c, &user)
+    if err != nil {
+        c.JSON(loginErrorStatus(err), gin.H{
+            "success": false,
+            "error": err.Error(),
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "message": "Authentication successful",
+        "access_token":  accessToken,
+        "refresh_token": refreshToken,
+        "user":          userResponse(&user),
+    })
+}
+
+// checkSecondFactor verifies a TOTP code, or the recovery code when one is
+// given. Wrong codes count towards a per-user lockout, so codes can't be
+// guessed by spreading attempts over IPs or fresh MFA tokens.
+func (h *Handler) checkSecondFactor(c *gin.Context, user *models.User, code, recoveryCode string) error {
+    ctx := c.Request.Context()
+    mfaConfig := h.cfg.MFA
+
+    // Take an attempt before checking, so parallel guesses can't get past
+    // the limit. Locked out users match nothing.
+    var counted models.User
+    err := config.UserCollection.FindOneAndUpdate(ctx,
+        bson.M{
+            "_id": user.ID,
+            "$or": bson.A{
+                bson.M{"mfa_locked_until": bson.M{"$exists": false}},
+                bson.M{"mfa_locked_until": bson.M{"$lte": time.Now()}},
+            },
+        },
+        bson.M{"$inc": bson.M{"mfa_attempts": 1}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&counted)
+    if err == mongo.ErrNoDocuments {
+        return errSecondFactorLocked
+    }
+    if err != nil {
+        return err
+    }
+    if counted.MFAAttempts > mfaConfig.MaxAttempts {
+        return h.lockSecondFactor(c, user)
+    }
+
+    var valid bool
+    if recoveryCode != "" {
+        valid, err = h.consumeRecoveryCode(c, user, recoveryCode)
+    } else {
+        valid, err = consumeTOTP(c.Request.Context(), user, code)
+    }
+    if err != nil {
+        return err
+    }
+
+    if !valid {
+        if counted.MFAAttempts >= mfaConfig.MaxAttempts {
+            return h.lockSecondFactor(c, user)
+        }
+        return errSecondFactorInvalid
+    }
+
+    _, err = config.UserCollection.UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$unset": bson.M{"mfa_attempts": "", "mfa_locked_until": ""}},
+    )
+    return err
+}
+
+// lockSecondFactor starts a lockout and starts the count afresh for when it ends
+func (h *Handler) lockSecondFactor(c *gin.Context, user *models.User) error {
+    mfaConfig := h.cfg.MFA
+    _, err := config.UserCollection.UpdateOne(c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{
+            "$set":   bson.M{"mfa_locked_until": time.Now().Add(mfaConfig.Lockout.Std())},
+            "$unset": bson.M{"mfa_attempts": ""},
+        },
+    )
+    if err != nil {
+        return err
+    }
+
+    recordAudit(c, models.AuditMFALockedOut, user.ID, gin.H{"lockout": mfaConfig.Lockout.Std().String()})
+    return errSecondFactorLocked
+}
+
+// respondSecondFactorError answers for an error from checkSecondFactor
+func respondSecondFactorError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, errSecondFactorLocked):
+        c.JSON(429, gin.H{
+            "success": false,
+            "error": err.Error(),
+        })
+    case errors.Is(err, errSecondFactorInvalid):
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": err.Error(),
+        })
+    default:
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Database error",
+        })
+    }
+}
+
+// consumeTOTP validates code and records its time step so the same code
+// can't be replayed within its validity window
+func consumeTOTP(ctx context.Context, user *models.User, code string) (bool, error) {
+    step, valid := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+    if !valid {
+        return false, nil
+    }
+
+    result, err := config.UserCollection.UpdateOne(
+        ctx,
+        bson.M{
+            "_id": user.ID,
+            "$or": bson.A{
+                bson.M{"totp_last_step": bson.M{"$lt": step}},
+                bson.M{"totp_last_step": bson.M{"$exists": false}},
+            },
+        },
+        bson.M{"$set": bson.M{"totp_last_step": step}},
+    )
+    if err != nil {
+        return false, err
+    }
+
+    return result.MatchedCount == 1, nil
+}
+
+// consumeRecoveryCode spends one recovery code. Pulling the hash in the
+// same update that matches it guarantees each code works only once. The
+// use is audited and the user is told by email.
+func (h *Handler) consumeRecoveryCode(c *gin.Context, user *models.User, code string) (bool, error) {
+    hash := utils.HashRecoveryCode(code)
+
+    result, err := config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID, "recovery_codes": hash},
+        bson.M{"$pull": bson.M{"recovery_codes": hash}},
+    )
+    if err != nil {
+        return false, err
+    }
+    if result.ModifiedCount != 1 {
+        return false, nil
+    }
+
+    remaining := len(user.RecoveryCodes) - 1
+    recordAudit(c, models.AuditRecoveryCodeUsed, user.ID, gin.H{"remaining": remaining})
+
+    locale := services.ResolveLocale(user.Locale, c.GetHeader("Accept-Language"))
+    device := services.DeviceInfo{IPAddress: middleware.ClientIP(c), UserAgent: c.Request.UserAgent()}
+    if err := h.email.SendRecoveryCodeUsedEmail(c.Request.Context(), user.Email, user.Name, locale, remaining, device); err != nil {
+        slog.ErrorContext(c.Request.Context(), "recovery code notification failed", "email", user.Email, "error", err)
+    }
+
+    return true, nil
+}
+
+// newRecoveryCodes returns a fresh set of codes to show the user once,
+// along with the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+    codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    hashes := make([]string, len(codes))
+    for i, code := range codes {
+        hashes[i] = utils.HashRecoveryCode(code)
+    }
+    return codes, hashes, nil
+}
+
+func enabledMFAMethods(user *models.User) []string {
+    methods := []string{}
+    if user.MFAEnabled {
+        methods = append(methods, "totp")
+    }
+    if len(user.RecoveryCodes) > 0 {
+        methods = append(methods, "recovery_code")
+    }
+    return methods
+}
+
+// recordAudit stores an audit event enriched with the request's client details
+func recordAudit(c *gin.Context, eventType string, userID primitive.ObjectID, details gin.H) {
+    // Anything done under impersonation is attributed to the admin too
+    if impersonator, ok := c.Get("impersonator"); ok {
+        if details == nil {
+            details = gin.H{}
+        }
+        details["impersonator_id"] = impersonator
+    }
+
+    services.NewAuditService().Record(c.Request.Context(), models.AuditEvent{
+        Type:      eventType,
+        UserID:    userID,
+        IPAddress: middleware.ClientIP(c),
+        UserAgent: c.Request.UserAgent(),
+        Details:   details,
+    })
+}
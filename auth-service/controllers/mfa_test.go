@@ -0,0 +1,158 @@
+package controllers
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// mfaUser stores a user with an authenticator app and one recovery code
+func mfaUser(t *testing.T, recoveryCode string) *models.User {
+    t.Helper()
+
+    secret, err := utils.GenerateTOTPSecret()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return insertUser(t, func(u *models.User) {
+        u.MFAEnabled = true
+        u.TOTPSecret = secret
+        u.RecoveryCodes = []string{utils.HashRecoveryCode(recoveryCode)}
+    })
+}
+
+// totpCodes returns the user's current code and one that is certainly wrong
+func totpCodes(t *testing.T, user *models.User) (string, string) {
+    t.Helper()
+
+    code, err := utils.TOTPCode(user.TOTPSecret, time.Now())
+    if err != nil {
+        t.Fatal(err)
+    }
+    wrong := []byte(code)
+    wrong[0] = '0' + (wrong[0]-'0'+5)%10
+    return code, string(wrong)
+}
+
+func mfaToken(t *testing.T, cfg *config.Config, user *models.User) string {
+    t.Helper()
+
+    token, err := utils.GenerateMFAToken(cfg.JWT, user.ID.Hex())
+    if err != nil {
+        t.Fatal(err)
+    }
+    return token
+}
+
+func TestVerifyMFA(t *testing.T) {
+    testDB(t)
+
+    cfg := testConfig()
+    cfg.MFA.MaxAttempts = 3
+    h := testHandler(t, cfg)
+
+    verify := func(body map[string]string) int {
+        return serve(h.VerifyMFA, "POST", "/auth/mfa/verify", body, nil).Code
+    }
+
+    t.Run("the MFA token works once", func(t *testing.T) {
+        user := mfaUser(t, "aaaaa-bbbbb")
+        token := mfaToken(t, cfg, user)
+        code, _ := totpCodes(t, user)
+
+        if status := verify(map[string]string{"mfa_token": token, "code": code}); status != 200 {
+            t.Fatalf("first verification status = %d, want 200", status)
+        }
+        if status := verify(map[string]string{"mfa_token": token, "recovery_code": "aaaaa-bbbbb"}); status != 401 {
+            t.Errorf("reused MFA token status = %d, want 401", status)
+        }
+    })
+
+    t.Run("a TOTP code cannot be replayed", func(t *testing.T) {
+        user := mfaUser(t, "aaaaa-bbbbb")
+        code, _ := totpCodes(t, user)
+
+        if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "code": code}); status != 200 {
+            t.Fatalf("first verification status = %d, want 200", status)
+        }
+        if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "code": code}); status != 401 {
+            t.Errorf("replayed code status = %d, want 401", status)
+        }
+    })
+
+    t.Run("a recovery code works once", func(t *testing.T) {
+        user := mfaUser(t, "aaaaa-bbbbb")
+
+        if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "recovery_code": "AAAAA-BBBBB"}); status != 200 {
+            t.Fatalf("first use status = %d, want 200", status)
+        }
+        if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "recovery_code": "aaaaa-bbbbb"}); status != 401 {
+            t.Errorf("second use status = %d, want 401", status)
+        }
+    })
+
+    t.Run("wrong codes lock the second factor", func(t *testing.T) {
+        user := mfaUser(t, "aaaaa-bbbbb")
+        code, wrong := totpCodes(t, user)
+
+        // Each guess comes with a fresh MFA token, as if the attacker
+        // logged in again with the email OTP every time
+        for i := 1; i < cfg.MFA.MaxAttempts; i++ {
+            if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "code": wrong}); status != 401 {
+                t.Fatalf("wrong code %d status = %d, want 401", i, status)
+            }
+        }
+        token := mfaToken(t, cfg, user)
+        if status := verify(map[string]string{"mfa_token": token, "code": wrong}); status != 429 {
+            t.Fatalf("wrong code %d status = %d, want 429", cfg.MFA.MaxAttempts, status)
+        }
+
+        if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "code": code}); status != 429 {
+            t.Errorf("right code while locked status = %d, want 429", status)
+        }
+        if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "recovery_code": "aaaaa-bbbbb"}); status != 429 {
+            t.Errorf("recovery code while locked status = %d, want 429", status)
+        }
+
+        // The lockout ends on its own; the token that hit it stays dead
+        _, err := config.UserCollection.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID},
+            bson.M{"$set": bson.M{"mfa_locked_until": time.Now().Add(-time.Second)}},
+        )
+        if err != nil {
+            t.Fatal(err)
+        }
+        if status := verify(map[string]string{"mfa_token": token, "code": code}); status != 401 {
+            t.Errorf("token used for the locking guess status = %d, want 401", status)
+        }
+        if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "code": code}); status != 200 {
+            t.Errorf("right code after the lockout status = %d, want 200", status)
+        }
+    })
+
+    t.Run("a correct code resets the count", func(t *testing.T) {
+        user := mfaUser(t, "aaaaa-bbbbb")
+        _, wrong := totpCodes(t, user)
+
+        for i := 1; i < cfg.MFA.MaxAttempts; i++ {
+            verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "code": wrong})
+        }
+        if status := verify(map[string]string{"mfa_token": mfaToken(t, cfg, user), "recovery_code": "aaaaa-bbbbb"}); status != 200 {
+            t.Fatalf("recovery code status = %d, want 200", status)
+        }
+
+        var stored models.User
+        if err := config.UserCollection.FindOne(context.Background(), bson.M{"_id": user.ID}).Decode(&stored); err != nil {
+            t.Fatal(err)
+        }
+        if stored.MFAAttempts != 0 {
+            t.Errorf("mfa_attempts = %d after a correct code, want 0", stored.MFAAttempts)
+        }
+    })
+}
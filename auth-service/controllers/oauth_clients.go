@@ -0,0 +1,423 @@
+package controllers
+
+import (
+    "context"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// Bounds for per-client token lifetimes, in seconds
+const (
+    minClientTokenTTL = 60
+    maxClientTokenTTL = 24 * 60 * 60
+)
+
+var supportedGrantTypes = []string{models.GrantAuthorizationCode, models.GrantClientCredentials, models.GrantDeviceCode, models.GrantTokenExchange}
+
+type clientRequest struct {
+    Name           *string   `json:"name"`
+    RedirectURIs   *[]string `json:"redirect_uris"`
+    AllowedScopes  *[]string `json:"allowed_scopes"`
+    GrantTypes     *[]string `json:"grant_types"`
+    AccessTokenTTL *int      `json:"access_token_ttl"`
+    IDTokenTTL     *int      `json:"id_token_ttl"`
+    Public         *bool     `json:"public"`
+}
+
+// apply copies the fields that were sent onto client
+func (r *clientRequest) apply(client *models.OAuthClient) {
+    if r.Name != nil {
+        client.Name = *r.Name
+    }
+    if r.RedirectURIs != nil {
+        client.RedirectURIs = *r.RedirectURIs
+    }
+    if r.AllowedScopes != nil {
+        client.AllowedScopes = *r.AllowedScopes
+    }
+    if r.GrantTypes != nil {
+        client.GrantTypes = *r.GrantTypes
+    }
+    if r.AccessTokenTTL != nil {
+        client.AccessTokenTTL = *r.AccessTokenTTL
+    }
+    if r.IDTokenTTL != nil {
+        client.IDTokenTTL = *r.IDTokenTTL
+    }
+}
+
+// ListClients returns every registered client, including disabled ones
+func ListClients(c *gin.Context) {
+    cursor, err := config.OAuthClientCollection.Find(
+        c.Request.Context(),
+        bson.M{},
+        options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Database error",
+        })
+        return
+    }
+
+    clients := []models.OAuthClient{}
+    if err := cursor.All(c.Request.Context(), &clients); err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Database error",
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "clients": clients,
+    })
+}
+
+func GetClient(c *gin.Context) {
+    client, ok := loadClientForAdmin(c)
+    if !ok {
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "client": client,
+    })
+}
+
+// CreateClient registers a client. The secret of a confidential client is
+// only ever returned here and by RotateClientSecret.
+func CreateClient(c *gin.Context) {
+    var req clientRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    client := models.OAuthClient{
+        AllowedScopes: []string{"openid"},
+        GrantTypes:    []string{models.GrantAuthorizationCode},
+        CreatedBy:     currentUserObjectID(c),
+    }
+    req.apply(&client)
+    if req.Public != nil {
+        client.Public = *req.Public
+    }
+
+    if msg := validateClient(&client); msg != "" {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": msg,
+        })
+        return
+    }
+
+    secret, err := createOAuthClient(c.Request.Context(), &client)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to create client",
+        })
+        return
+    }
+
+    recordAudit(c, models.AuditClientCreated, currentUserObjectID(c), gin.H{"client_id": client.ClientID})
+
+    response := gin.H{
+        "success": true,
+        "client": client,
+    }
+    if secret != "" {
+        response["client_secret"] = secret
+    }
+    c.JSON(201, response)
+}
+
+// UpdateClient changes a client's settings. Only the fields sent are
+// touched; whether a client is public cannot be changed after creation.
+func UpdateClient(c *gin.Context) {
+    client, ok := loadClientForAdmin(c)
+    if !ok {
+        return
+    }
+
+    var req clientRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+    if req.Public != nil && *req.Public != client.Public {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "A client cannot switch between public and confidential",
+        })
+        return
+    }
+
+    req.apply(client)
+    if msg := validateClient(client); msg != "" {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": msg,
+        })
+        return
+    }
+
+    client.UpdatedAt = time.Now()
+    _, err := config.OAuthClientCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": client.ID},
+        bson.M{"$set": bson.M{
+            "name":             client.Name,
+            "redirect_uris":    client.RedirectURIs,
+            "allowed_scopes":   client.AllowedScopes,
+            "grant_types":      client.GrantTypes,
+            "access_token_ttl": client.AccessTokenTTL,
+            "id_token_ttl":     client.IDTokenTTL,
+            "updated_at":       client.UpdatedAt,
+        }},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to update client",
+        })
+        return
+    }
+
+    recordAudit(c, models.AuditClientUpdated, currentUserObjectID(c), gin.H{"client_id": client.ClientID})
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "client": client,
+    })
+}
+
+// RotateClientSecret replaces a confidential client's secret. The old
+// secret stops working immediately.
+func RotateClientSecret(c *gin.Context) {
+    client, ok := loadClientForAdmin(c)
+    if !ok {
+        return
+    }
+
+    if client.Public {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Public clients have no secret",
+        })
+        return
+    }
+
+    secret, hash, err := newClientSecret()
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to generate client secret",
+        })
+        return
+    }
+
+    now := time.Now()
+    _, err = config.OAuthClientCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": client.ID},
+        bson.M{"$set": bson.M{
+            "secret_hash":       hash,
+            "secret_rotated_at": now,
+            "updated_at":        now,
+        }},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to rotate client secret",
+        })
+        return
+    }
+
+    recordAudit(c, models.AuditClientSecretRotated, currentUserObjectID(c), gin.H{"client_id": client.ClientID})
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "client_id":     client.ClientID,
+        "client_secret": secret,
+    })
+}
+
+func DisableClient(c *gin.Context) {
+    setClientDisabled(c, true)
+}
+
+func EnableClient(c *gin.Context) {
+    setClientDisabled(c, false)
+}
+
+// setClientDisabled stops (or resumes) a client obtaining new tokens.
+// Tokens it already holds keep working until they expire.
+func setClientDisabled(c *gin.Context, disabled bool) {
+    client, ok := loadClientForAdmin(c)
+    if !ok {
+        return
+    }
+
+    _, err := config.OAuthClientCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": client.ID},
+        bson.M{"$set": bson.M{"disabled": disabled, "updated_at": time.Now()}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to update client",
+        })
+        return
+    }
+
+    event := models.AuditClientEnabled
+    if disabled {
+        event = models.AuditClientDisabled
+    }
+    recordAudit(c, event, currentUserObjectID(c), gin.H{"client_id": client.ClientID})
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "client_id": client.ClientID,
+        "disabled":  disabled,
+    })
+}
+
+// validateClient checks client settings and returns a message describing
+// the first problem, or "" if there is none
+func validateClient(client *models.OAuthClient) string {
+    if client.Name == "" {
+        return "name is required"
+    }
+
+    if len(client.GrantTypes) == 0 {
+        return "At least one grant type is required"
+    }
+    for _, grant := range client.GrantTypes {
+        if !containsString(supportedGrantTypes, grant) {
+            return "Unsupported grant type: " + grant
+        }
+    }
+
+    if client.Public && containsString(client.GrantTypes, models.GrantClientCredentials) {
+        return "Public clients cannot use the client_credentials grant"
+    }
+    if client.Public && containsString(client.GrantTypes, models.GrantTokenExchange) {
+        return "Public clients cannot use token exchange"
+    }
+
+    if containsString(client.GrantTypes, models.GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+        return "redirect_uris are required for the authorization_code grant"
+    }
+    for _, uri := range client.RedirectURIs {
+        if !validRedirectURI(uri) {
+            return "Redirect URIs must be absolute https URLs (http is allowed for localhost) without a fragment"
+        }
+    }
+
+    for _, scope := range client.AllowedScopes {
+        if !containsString(supportedScopes, scope) && !containsString(serviceScopes, scope) {
+            return "Unsupported scope: " + scope
+        }
+    }
+
+    for _, ttl := range []int{client.AccessTokenTTL, client.IDTokenTTL} {
+        if ttl != 0 && (ttl < minClientTokenTTL || ttl > maxClientTokenTTL) {
+            return "Token lifetimes must be between 60 seconds and 24 hours"
+        }
+    }
+
+    return ""
+}
+
+// createOAuthClient assigns a client ID (and a secret for confidential
+// clients) and stores the client. It returns the plaintext secret.
+func createOAuthClient(ctx context.Context, client *models.OAuthClient) (string, error) {
+    clientID, err := utils.GenerateSecureToken(16)
+    if err != nil {
+        return "", err
+    }
+
+    client.ID = primitive.NewObjectID()
+    client.ClientID = clientID
+    client.CreatedAt = time.Now()
+    client.UpdatedAt = client.CreatedAt
+
+    secret := ""
+    if !client.Public {
+        secret, client.SecretHash, err = newClientSecret()
+        if err != nil {
+            return "", err
+        }
+    }
+
+    if _, err := config.OAuthClientCollection.InsertOne(ctx, client); err != nil {
+        return "", err
+    }
+    return secret, nil
+}
+
+func newClientSecret() (string, string, error) {
+    secret, err := utils.GenerateSecureToken(32)
+    if err != nil {
+        return "", "", err
+    }
+    hash, err := utils.HashPassword(secret)
+    if err != nil {
+        return "", "", err
+    }
+    return secret, hash, nil
+}
+
+// clientTokenTTL returns the client's configured lifetime, or fallback
+func clientTokenTTL(seconds int, fallback time.Duration) time.Duration {
+    if seconds <= 0 {
+        return fallback
+    }
+    return time.Duration(seconds) * time.Second
+}
+
+// loadClientForAdmin loads the :client_id client whether or not it is disabled
+func loadClientForAdmin(c *gin.Context) (*models.OAuthClient, bool) {
+    var client models.OAuthClient
+    err := config.OAuthClientCollection.FindOne(
+        c.Request.Context(),
+        bson.M{"client_id": c.Param("client_id")},
+    ).Decode(&client)
+    if err != nil {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Client not found",
+        })
+        return nil, false
+    }
+    return &client, true
+}
+
+func currentUserObjectID(c *gin.Context) primitive.ObjectID {
+    userID, _ := c.Get("user_id")
+    id, _ := userID.(string)
+    objID, _ := primitive.ObjectIDFromHex(id)
+    return objID
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/Anurag-spec1/goauthenticate/models"
+)
+
+func TestValidateClient(t *testing.T) {
+    webApp := func() *models.OAuthClient {
+        return &models.OAuthClient{
+            Name:          "Library",
+            RedirectURIs:  []string{"https://library.example.edu/callback"},
+            AllowedScopes: []string{"openid", "email"},
+            GrantTypes:    []string{models.GrantAuthorizationCode},
+        }
+    }
+
+    tests := []struct {
+        name    string
+        modify  func(*models.OAuthClient)
+        wantErr string
+    }{
+        {"valid web app", func(c *models.OAuthClient) {}, ""},
+        {"valid public app", func(c *models.OAuthClient) { c.Public = true }, ""},
+        {"valid service", func(c *models.OAuthClient) {
+            c.RedirectURIs = nil
+            c.AllowedScopes = []string{"users:read"}
+            c.GrantTypes = []string{models.GrantClientCredentials, models.GrantTokenExchange}
+        }, ""},
+        {"localhost over http", func(c *models.OAuthClient) {
+            c.RedirectURIs = []string{"http://localhost:3000/callback", "http://127.0.0.1/cb"}
+        }, ""},
+        {"token lifetimes at the limits", func(c *models.OAuthClient) {
+            c.AccessTokenTTL = minClientTokenTTL
+            c.IDTokenTTL = maxClientTokenTTL
+        }, ""},
+        {"missing name", func(c *models.OAuthClient) { c.Name = "" }, "name is required"},
+        {"no grant types", func(c *models.OAuthClient) { c.GrantTypes = nil }, "At least one grant type"},
+        {"unsupported grant type", func(c *models.OAuthClient) {
+            c.GrantTypes = []string{"password"}
+        }, "Unsupported grant type: password"},
+        {"public client credentials", func(c *models.OAuthClient) {
+            c.Public = true
+            c.GrantTypes = []string{models.GrantClientCredentials}
+        }, "client_credentials"},
+        {"public token exchange", func(c *models.OAuthClient) {
+            c.Public = true
+            c.GrantTypes = []string{models.GrantTokenExchange}
+        }, "token exchange"},
+        {"authorization code without redirect", func(c *models.OAuthClient) {
+            c.RedirectURIs = nil
+        }, "redirect_uris are required"},
+        {"http redirect", func(c *models.OAuthClient) {
+            c.RedirectURIs = []string{"http://library.example.edu/callback"}
+        }, "Redirect URIs"},
+        {"relative redirect", func(c *models.OAuthClient) {
+            c.RedirectURIs = []string{"/callback"}
+        }, "Redirect URIs"},
+        {"redirect with fragment", func(c *models.OAuthClient) {
+            c.RedirectURIs = []string{"https://library.example.edu/callback#done"}
+        }, "Redirect URIs"},
+        {"unsupported scope", func(c *models.OAuthClient) {
+            c.AllowedScopes = []string{"openid", "admin"}
+        }, "Unsupported scope: admin"},
+        {"access token lifetime too short", func(c *models.OAuthClient) {
+            c.AccessTokenTTL = minClientTokenTTL - 1
+        }, "Token lifetimes"},
+        {"id token lifetime too long", func(c *models.OAuthClient) {
+            c.IDTokenTTL = maxClientTokenTTL + 1
+        }, "Token lifetimes"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            client := webApp()
+            tt.modify(client)
+
+            got := validateClient(client)
+            if tt.wantErr == "" {
+                if got != "" {
+                    t.Errorf("validateClient() = %q, want no error", got)
+                }
+                return
+            }
+            if !strings.Contains(got, tt.wantErr) {
+                t.Errorf("validateClient() = %q, want it to mention %q", got, tt.wantErr)
+            }
+        })
+    }
+}
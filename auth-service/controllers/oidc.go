@@ -0,0 +1,683 @@
+package controllers
+
+import (
+    "context"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/metrics"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/services"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+const (
+    authRequestLifetime = 10 * time.Minute
+    authCodeLifetime    = 60 * time.Second
+    oidcAccessTokenTTL  = 15 * time.Minute
+    idTokenTTL          = time.Hour
+    serviceTokenTTL     = 5 * time.Minute
+)
+
+// Scopes we understand. "student" releases the details parsed from the
+// college email (roll number, branch, batch and year).
+var supportedScopes = []string{"openid", "profile", "email", "student"}
+
+// Scopes only service clients can hold, via the client_credentials grant.
+// "users:read" lets backend jobs look up any user.
+var serviceScopes = []string{"users:read"}
+
+var supportedClaims = []string{
+    "sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash",
+    "name", "locale", "email", "email_verified",
+    "roll_number", "branch", "batch", "admission_year", "current_year", "year_number",
+}
+
+// OpenIDConfiguration serves /.well-known/openid-configuration
+func (h *Handler) OpenIDConfiguration(c *gin.Context) {
+    issuer := h.oidcIssuer()
+
+    discovery := gin.H{
+        "issuer":                                issuer,
+        "authorization_endpoint":                issuer + "/oauth/authorize",
+        "token_endpoint":                        issuer + "/oauth/token",
+        "userinfo_endpoint":                     issuer + "/oauth/userinfo",
+        "jwks_uri":                              issuer + "/oauth/jwks",
+        "registration_endpoint":                 issuer + "/oauth/register",
+        "introspection_endpoint":                issuer + "/oauth/introspect",
+        "revocation_endpoint":                   issuer + "/oauth/revoke",
+        "response_types_supported":              []string{"code"},
+        "grant_types_supported":                 supportedGrantTypes,
+        "subject_types_supported":               []string{"public"},
+        "id_token_signing_alg_values_supported": []string{"RS256"},
+        "scopes_supported":                      supportedScopes,
+        "claims_supported":                      supportedClaims,
+        "token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+        "code_challenge_methods_supported":      []string{"S256"},
+    }
+    if h.deviceFlowEnabled(c) {
+        discovery["device_authorization_endpoint"] = issuer + "/oauth/device_authorization"
+    }
+
+    c.JSON(200, discovery)
+}
+
+func JWKS(c *gin.Context) {
+    keys, err := services.NewKeyService().JWKS()
+    if err != nil {
+        oauthError(c, 500, "server_error", "Signing keys are unavailable")
+        return
+    }
+
+    c.Header("Cache-Control", "public, max-age=300")
+    c.JSON(200, gin.H{"keys": keys})
+}
+
+// RegisterClient is a minimal RFC 7591 dynamic client registration endpoint,
+// guarded by the configured registration token, sent as a bearer token. Clients registering
+// with token_endpoint_auth_method "none" are public and get no secret.
+func (h *Handler) RegisterClient(c *gin.Context) {
+    registrationToken := h.cfg.OIDC.RegistrationToken
+    provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+    if registrationToken == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(registrationToken)) != 1 {
+        oauthError(c, 401, "invalid_token", "A valid registration token is required")
+        return
+    }
+
+    var req struct {
+        ClientName              string   `json:"client_name" binding:"required"`
+        RedirectURIs            []string `json:"redirect_uris" binding:"required,min=1"`
+        TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+        Scope                   string   `json:"scope"`
+    }
+
+    if err := c.ShouldBindJSON(&req); err != nil {
+        oauthError(c, 400, "invalid_client_metadata", err.Error())
+        return
+    }
+
+    authMethod := req.TokenEndpointAuthMethod
+    if authMethod == "" {
+        authMethod = "client_secret_basic"
+    }
+    if authMethod != "none" && authMethod != "client_secret_basic" && authMethod != "client_secret_post" {
+        oauthError(c, 400, "invalid_client_metadata", "Unsupported token_endpoint_auth_method")
+        return
+    }
+
+    client := models.OAuthClient{
+        Name:          req.ClientName,
+        RedirectURIs:  req.RedirectURIs,
+        AllowedScopes: strings.Fields(req.Scope),
+        GrantTypes:    []string{models.GrantAuthorizationCode},
+        Public:        authMethod == "none",
+    }
+    if len(client.AllowedScopes) == 0 {
+        client.AllowedScopes = supportedScopes
+    }
+    if msg := validateClient(&client); msg != "" {
+        oauthError(c, 400, "invalid_client_metadata", msg)
+        return
+    }
+
+    secret, err := createOAuthClient(c.Request.Context(), &client)
+    if err != nil {
+        oauthError(c, 500, "server_error", "Failed to store client")
+        return
+    }
+
+    response := gin.H{
+        "client_id":                  client.ClientID,
+        "client_id_issued_at":        client.CreatedAt.Unix(),
+        "client_name":                client.Name,
+        "redirect_uris":              client.RedirectURIs,
+        "token_endpoint_auth_method": authMethod,
+        "grant_types":                client.GrantTypes,
+        "response_types":             []string{"code"},
+        "scope":                      strings.Join(client.AllowedScopes, " "),
+    }
+    if secret != "" {
+        response["client_secret"] = secret
+        response["client_secret_expires_at"] = 0
+    }
+
+    c.JSON(201, response)
+}
+
+// Authorize validates an authorization code request and hands the user to
+// the login UI (OIDC_LOGIN_URL) with an auth_request ID. The UI signs the
+// user in with the usual OTP flow, shows the consent screen using
+// GetAuthorizationRequest and finishes with ApproveAuthorization.
+//
+// Only the code flow with PKCE (S256) is supported.
+func (h *Handler) Authorize(c *gin.Context) {
+    clientID := c.Query("client_id")
+    redirectURI := c.Query("redirect_uri")
+
+    // Until the client and redirect URI check out, errors must not be
+    // redirected anywhere
+    client, err := findOAuthClient(c.Request.Context(), clientID)
+    if err != nil {
+        oauthError(c, 400, "invalid_client", "Unknown client_id")
+        return
+    }
+    if !containsString(client.RedirectURIs, redirectURI) {
+        oauthError(c, 400, "invalid_request", "redirect_uri is not registered for this client")
+        return
+    }
+
+    state := c.Query("state")
+    fail := func(code, description string) {
+        redirectWithParams(c, redirectURI, url.Values{
+            "error":             {code},
+            "error_description": {description},
+            "state":             {state},
+        }, false)
+    }
+
+    if c.Query("response_type") != "code" {
+        fail("unsupported_response_type", "Only response_type=code is supported")
+        return
+    }
+
+    scopes := strings.Fields(c.Query("scope"))
+    if !containsString(scopes, "openid") {
+        fail("invalid_scope", "The openid scope is required")
+        return
+    }
+    for _, scope := range scopes {
+        if !containsString(supportedScopes, scope) || !containsString(client.AllowedScopes, scope) {
+            fail("invalid_scope", "Scope not allowed for this client: "+scope)
+            return
+        }
+    }
+
+    if !containsString(client.GrantTypes, models.GrantAuthorizationCode) {
+        fail("unauthorized_client", "This client may not use the authorization code flow")
+        return
+    }
+
+    codeChallenge := c.Query("code_challenge")
+    if codeChallenge == "" || c.Query("code_challenge_method") != "S256" {
+        fail("invalid_request", "PKCE with code_challenge_method=S256 is required")
+        return
+    }
+
+    requestID, err := utils.GenerateSecureToken(24)
+    if err != nil {
+        fail("server_error", "Failed to create authorization request")
+        return
+    }
+
+    _, err = config.AuthRequestCollection.InsertOne(c.Request.Context(), models.AuthorizationRequest{
+        ID:                  requestID,
+        ClientID:            client.ClientID,
+        RedirectURI:         redirectURI,
+        Scope:               strings.Join(scopes, " "),
+        State:               state,
+        Nonce:               c.Query("nonce"),
+        CodeChallenge:       codeChallenge,
+        CodeChallengeMethod: "S256",
+        ExpiresAt:           time.Now().Add(authRequestLifetime),
+    })
+    if err != nil {
+        fail("server_error", "Failed to create authorization request")
+        return
+    }
+
+    loginURL := h.cfg.OIDC.LoginURL
+    if loginURL == "" {
+        c.JSON(200, gin.H{
+            "success": true,
+            "auth_request": requestID,
+            "message":      "Sign in, then approve with POST /api/oauth/authorize",
+        })
+        return
+    }
+
+    redirectWithParams(c, loginURL, url.Values{"auth_request": {requestID}}, false)
+}
+
+// GetAuthorizationRequest describes a pending request for the consent screen
+func GetAuthorizationRequest(c *gin.Context) {
+    var req models.AuthorizationRequest
+    err := config.AuthRequestCollection.FindOne(
+        c.Request.Context(),
+        bson.M{"_id": c.Param("id"), "expires_at": bson.M{"$gt": time.Now()}},
+    ).Decode(&req)
+    if err != nil {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Authorization request not found or expired",
+        })
+        return
+    }
+
+    client, err := findOAuthClient(c.Request.Context(), req.ClientID)
+    if err != nil {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Client no longer exists",
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "client_name":  client.Name,
+        "client_id":    client.ClientID,
+        "scopes":       strings.Fields(req.Scope),
+        "redirect_uri": req.RedirectURI,
+    })
+}
+
+// ApproveAuthorization is called by the login UI, with the signed-in user's
+// access token, once the user approves or denies the request. It returns
+// the client redirect URL the UI should navigate to.
+func ApproveAuthorization(c *gin.Context) {
+    var body struct {
+        AuthRequest string `json:"auth_request" binding:"required"`
+        Approve     bool   `json:"approve"`
+    }
+
+    if err := c.ShouldBindJSON(&body); err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid request",
+        })
+        return
+    }
+
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    // Each request can be answered once
+    var req models.AuthorizationRequest
+    err := config.AuthRequestCollection.FindOneAndDelete(
+        c.Request.Context(),
+        bson.M{"_id": body.AuthRequest, "expires_at": bson.M{"$gt": time.Now()}},
+    ).Decode(&req)
+    if err != nil {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Authorization request not found or expired",
+        })
+        return
+    }
+
+    redirectTo, _ := url.Parse(req.RedirectURI)
+    q := redirectTo.Query()
+    if req.State != "" {
+        q.Set("state", req.State)
+    }
+
+    if !body.Approve {
+        q.Set("error", "access_denied")
+        q.Set("error_description", "The user denied the request")
+        redirectTo.RawQuery = q.Encode()
+        c.JSON(200, gin.H{
+            "success": true,
+            "redirect_to": redirectTo.String(),
+        })
+        return
+    }
+
+    code, err := utils.GenerateSecureToken(32)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to generate authorization code",
+        })
+        return
+    }
+
+    _, err = config.AuthCodeCollection.InsertOne(c.Request.Context(), models.AuthorizationCode{
+        CodeHash:      utils.HashToken(code),
+        ClientID:      req.ClientID,
+        UserID:        user.ID,
+        RedirectURI:   req.RedirectURI,
+        Scope:         req.Scope,
+        Nonce:         req.Nonce,
+        CodeChallenge: req.CodeChallenge,
+        AuthTime:      time.Now(),
+        ExpiresAt:     time.Now().Add(authCodeLifetime),
+    })
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to store authorization code",
+        })
+        return
+    }
+
+    q.Set("code", code)
+    redirectTo.RawQuery = q.Encode()
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "redirect_to": redirectTo.String(),
+    })
+}
+
+// Token is the OAuth 2.0 token endpoint
+func (h *Handler) Token(c *gin.Context) {
+    c.Header("Cache-Control", "no-store")
+    c.Header("Pragma", "no-cache")
+
+    switch c.PostForm("grant_type") {
+    case models.GrantAuthorizationCode:
+        h.tokenFromAuthorizationCode(c)
+    case models.GrantClientCredentials:
+        h.tokenFromClientCredentials(c)
+    case models.GrantDeviceCode:
+        h.tokenFromDeviceCode(c)
+    case models.GrantTokenExchange:
+        h.tokenFromExchange(c)
+    default:
+        oauthError(c, 400, "unsupported_grant_type", "Unsupported grant_type")
+    }
+}
+
+func (h *Handler) tokenFromAuthorizationCode(c *gin.Context) {
+    client, ok := authenticateClient(c)
+    if !ok {
+        return
+    }
+
+    // Deleting on read makes the code single-use
+    var code models.AuthorizationCode
+    err := config.AuthCodeCollection.FindOneAndDelete(
+        c.Request.Context(),
+        bson.M{"_id": utils.HashToken(c.PostForm("code")), "expires_at": bson.M{"$gt": time.Now()}},
+    ).Decode(&code)
+    if err != nil {
+        oauthError(c, 400, "invalid_grant", "Invalid or expired authorization code")
+        return
+    }
+
+    if !containsString(client.GrantTypes, models.GrantAuthorizationCode) {
+        oauthError(c, 400, "unauthorized_client", "This client may not use the authorization code flow")
+        return
+    }
+
+    if code.ClientID != client.ClientID || code.RedirectURI != c.PostForm("redirect_uri") {
+        oauthError(c, 400, "invalid_grant", "Authorization code was issued to another client or redirect_uri")
+        return
+    }
+
+    if !verifyPKCE(c.PostForm("code_verifier"), code.CodeChallenge) {
+        oauthError(c, 400, "invalid_grant", "PKCE verification failed")
+        return
+    }
+
+    var user models.User
+    err = config.UserCollection.FindOne(c.Request.Context(), bson.M{"_id": code.UserID}).Decode(&user)
+    if err != nil {
+        oauthError(c, 400, "invalid_grant", "User no longer exists")
+        return
+    }
+    if user.Suspended {
+        oauthError(c, 400, "invalid_grant", errAccountSuspended.Error())
+        return
+    }
+
+    accessTTL := clientTokenTTL(client.AccessTokenTTL, oidcAccessTokenTTL)
+    accessToken, err := utils.GenerateClientAccessToken(h.cfg.JWT, user.ID.Hex(), client.ClientID, code.Scope, accessTTL)
+    if err != nil {
+        oauthError(c, 500, "server_error", "Failed to generate access token")
+        return
+    }
+
+    idToken, err := h.signIDToken(c, client, &user, code.Scope, code.Nonce, code.AuthTime, accessToken)
+    if err != nil {
+        oauthError(c, 500, "server_error", "Failed to sign ID token")
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "access_token": accessToken,
+        "token_type":   "Bearer",
+        "expires_in":   int(accessTTL.Seconds()),
+        "id_token":     idToken,
+        "scope":        code.Scope,
+    })
+}
+
+// signIDToken builds and signs the ID token that accompanies accessToken
+func (h *Handler) signIDToken(c *gin.Context, client *models.OAuthClient, user *models.User, scope, nonce string, authTime time.Time, accessToken string) (string, error) {
+    now := time.Now()
+    claims := jwt.MapClaims{
+        "iss":       h.oidcIssuer(),
+        "sub":       user.ID.Hex(),
+        "aud":       client.ClientID,
+        "iat":       now.Unix(),
+        "exp":       now.Add(clientTokenTTL(client.IDTokenTTL, idTokenTTL)).Unix(),
+        "auth_time": authTime.Unix(),
+        "at_hash":   accessTokenHash(accessToken),
+    }
+    if nonce != "" {
+        claims["nonce"] = nonce
+    }
+    for k, v := range scopedUserClaims(user, strings.Fields(scope)) {
+        claims[k] = v
+    }
+
+    signed, err := services.NewKeyService().Sign(claims)
+    if err == nil {
+        metrics.TokensIssued.WithLabelValues("id_token").Inc()
+    }
+    return signed, err
+}
+
+// tokenFromClientCredentials issues a service token to a confidential
+// client acting on its own behalf. There is no refresh token; the client
+// simply asks again.
+func (h *Handler) tokenFromClientCredentials(c *gin.Context) {
+    client, ok := authenticateClient(c)
+    if !ok {
+        return
+    }
+
+    if client.Public || !containsString(client.GrantTypes, models.GrantClientCredentials) {
+        oauthError(c, 400, "unauthorized_client", "This client may not use the client_credentials grant")
+        return
+    }
+
+    // Without a scope parameter the client gets everything it is allowed
+    scopes := strings.Fields(c.PostForm("scope"))
+    if len(scopes) == 0 {
+        scopes = client.AllowedScopes
+    }
+    for _, scope := range scopes {
+        if !containsString(client.AllowedScopes, scope) {
+            oauthError(c, 400, "invalid_scope", "Scope not allowed for this client: "+scope)
+            return
+        }
+    }
+    scope := strings.Join(scopes, " ")
+
+    ttl := clientTokenTTL(client.AccessTokenTTL, serviceTokenTTL)
+    accessToken, err := utils.GenerateServiceToken(h.cfg.JWT, client.ClientID, scope, ttl)
+    if err != nil {
+        oauthError(c, 500, "server_error", "Failed to generate access token")
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "access_token": accessToken,
+        "token_type":   "Bearer",
+        "expires_in":   int(ttl.Seconds()),
+        "scope":        scope,
+    })
+}
+
+// UserInfo returns the claims the access token's scopes allow. Tokens
+// issued directly by VerifyOTP carry no scope and see everything.
+func UserInfo(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    scopes := supportedScopes
+    if scope, exists := c.Get("scope"); exists {
+        scopes = strings.Fields(scope.(string))
+    }
+
+    claims := scopedUserClaims(user, scopes)
+    claims["sub"] = user.ID.Hex()
+    c.JSON(200, claims)
+}
+
+// scopedUserClaims maps models.User onto the claims released by each scope
+func scopedUserClaims(user *models.User, scopes []string) gin.H {
+    claims := gin.H{}
+
+    if containsString(scopes, "profile") {
+        claims["name"] = user.Name
+        claims["locale"] = services.ResolveLocale(user.Locale, "")
+    }
+    if containsString(scopes, "email") {
+        claims["email"] = user.Email
+        claims["email_verified"] = user.IsVerified
+    }
+    if containsString(scopes, "student") {
+        claims["roll_number"] = user.RollNumber
+        claims["branch"] = user.Branch
+        claims["batch"] = user.Batch
+        claims["admission_year"] = user.AdmissionYear
+        claims["current_year"] = user.CurrentYear
+        claims["year_number"] = user.YearNumber
+    }
+
+    return claims
+}
+
+// authenticateClient identifies the calling client from HTTP Basic auth or
+// client_id/client_secret form fields. Public clients only send client_id.
+func authenticateClient(c *gin.Context) (*models.OAuthClient, bool) {
+    clientID, secret, usedBasic := c.Request.BasicAuth()
+    if !usedBasic {
+        clientID = c.PostForm("client_id")
+        secret = c.PostForm("client_secret")
+    } else {
+        // Basic credentials are form-encoded (RFC 6749 section 2.3.1)
+        clientID, _ = url.QueryUnescape(clientID)
+        secret, _ = url.QueryUnescape(secret)
+    }
+
+    fail := func() (*models.OAuthClient, bool) {
+        if usedBasic {
+            c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+        }
+        oauthError(c, 401, "invalid_client", "Client authentication failed")
+        return nil, false
+    }
+
+    client, err := findOAuthClient(c.Request.Context(), clientID)
+    if err != nil {
+        return fail()
+    }
+
+    if client.Public {
+        if secret != "" {
+            return fail()
+        }
+        return client, true
+    }
+
+    if secret == "" || utils.CheckPassword(client.SecretHash, secret) != nil {
+        return fail()
+    }
+    return client, true
+}
+
+// findOAuthClient looks up an enabled client. Disabled clients are treated
+// as unknown everywhere.
+func findOAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+    if clientID == "" {
+        return nil, mongo.ErrNoDocuments
+    }
+
+    var client models.OAuthClient
+    err := config.OAuthClientCollection.FindOne(
+        ctx,
+        bson.M{"client_id": clientID, "disabled": bson.M{"$ne": true}},
+    ).Decode(&client)
+    if err != nil {
+        return nil, err
+    }
+
+    // Clients registered before per-client scopes and grants existed
+    if len(client.AllowedScopes) == 0 {
+        client.AllowedScopes = supportedScopes
+    }
+    if len(client.GrantTypes) == 0 {
+        client.GrantTypes = []string{models.GrantAuthorizationCode}
+    }
+    return &client, nil
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+    if len(verifier) < 43 || len(verifier) > 128 {
+        return false
+    }
+    sum := sha256.Sum256([]byte(verifier))
+    computed := base64.RawURLEncoding.EncodeToString(sum[:])
+    return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// accessTokenHash computes the at_hash ID token claim for RS256
+func accessTokenHash(accessToken string) string {
+    sum := sha256.Sum256([]byte(accessToken))
+    return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+func validRedirectURI(raw string) bool {
+    u, err := url.Parse(raw)
+    if err != nil || !u.IsAbs() || u.Fragment != "" || u.Host == "" {
+        return false
+    }
+    if u.Scheme == "https" {
+        return true
+    }
+    host := u.Hostname()
+    return u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
+}
+
+// oidcIssuer is the configured issuer. It is never taken from the request:
+// a forged Host header would otherwise change the iss of signed tokens and
+// the endpoints advertised by discovery.
+func (h *Handler) oidcIssuer() string {
+    return strings.TrimRight(h.cfg.OIDC.Issuer, "/")
+}
+
+// oauthError writes an RFC 6749 style error body, which OAuth and OIDC
+// client libraries expect instead of our usual success/error shape
+func oauthError(c *gin.Context, status int, code, description string) {
+    c.JSON(status, gin.H{
+        "error":             code,
+        "error_description": description,
+    })
+}
+
+func containsString(list []string, s string) bool {
+    for _, item := range list {
+        if item == s {
+            return true
+        }
+    }
+    return false
+}
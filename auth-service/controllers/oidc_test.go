@@ -0,0 +1,47 @@
+package controllers
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "strings"
+    "testing"
+)
+
+func s256(verifier string) string {
+    sum := sha256.Sum256([]byte(verifier))
+    return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyPKCE(t *testing.T) {
+    // RFC 7636 appendix B
+    const (
+        verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+        challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+    )
+
+    tests := []struct {
+        name      string
+        verifier  string
+        challenge string
+        want      bool
+    }{
+        {"rfc example", verifier, challenge, true},
+        {"wrong verifier", strings.Replace(verifier, "d", "e", 1), challenge, false},
+        {"wrong challenge", verifier, strings.Replace(challenge, "E", "F", 1), false},
+        {"plain method", verifier, verifier, false},
+        {"padded challenge", verifier, challenge + "=", false},
+        {"shortest verifier", strings.Repeat("a", 43), s256(strings.Repeat("a", 43)), true},
+        {"longest verifier", strings.Repeat("a", 128), s256(strings.Repeat("a", 128)), true},
+        {"verifier too short", strings.Repeat("a", 42), s256(strings.Repeat("a", 42)), false},
+        {"verifier too long", strings.Repeat("a", 129), s256(strings.Repeat("a", 129)), false},
+        {"empty", "", "", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+                t.Errorf("verifyPKCE(%q, %q) = %v, want %v", tt.verifier, tt.challenge, got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import (
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// privacyModeEnabled reports whether privacy mode is on. In privacy mode
+// the OTP endpoints answer identically whether or not an account exists,
+// and student details parsed from the email are only returned once the
+// OTP has been verified.
+func (h *Handler) privacyModeEnabled(c *gin.Context) bool {
+    return h.cfg.Privacy.Mode
+}
+
+// padResponseTime sleeps until at least the configured minimum response
+// time has passed since start, so the work done for existing and unknown
+// accounts cannot be told apart by timing. It does nothing outside
+// privacy mode.
+func (h *Handler) padResponseTime(c *gin.Context, start time.Time) {
+    cfg := h.cfg.Privacy
+    if !cfg.Mode {
+        return
+    }
+
+    floor := time.Duration(cfg.MinResponseMS) * time.Millisecond
+    if remaining := floor - time.Since(start); remaining > 0 {
+        time.Sleep(remaining)
+    }
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+    "reflect"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+)
+
+func TestPrivacyModeResponses(t *testing.T) {
+    testDB(t)
+
+    cfg := testConfig()
+    cfg.Privacy.Mode = true
+    cfg.Privacy.MinResponseMS = 150
+    cfg.Challenge.Mode = config.ChallengeOff
+    cfg.OTP.MaxAttempts = 1
+    h := testHandler(t, cfg)
+
+    insertUser(t, func(u *models.User) { u.Email = "anurag.2428cse2059@kiet.edu" })
+
+    // call runs one request, checks it took at least the minimum response
+    // time and returns its status and body without the echoed email
+    call := func(t *testing.T, handler gin.HandlerFunc, target string, body map[string]string) (int, map[string]interface{}) {
+        t.Helper()
+
+        start := time.Now()
+        w := serve(handler, "POST", target, body, nil)
+        if elapsed, floor := time.Since(start), time.Duration(cfg.Privacy.MinResponseMS)*time.Millisecond; elapsed < floor {
+            t.Errorf("%s answered after %v, want at least %v", target, elapsed, floor)
+        }
+
+        decoded := decode(t, w)
+        delete(decoded, "email")
+        return w.Code, decoded
+    }
+    requestOTP := func(t *testing.T, email string) (int, map[string]interface{}) {
+        t.Helper()
+        return call(t, h.RequestOTP, "/auth/request-otp", map[string]string{"email": email})
+    }
+    verifyOTP := func(t *testing.T, email, otp string) (int, map[string]interface{}) {
+        t.Helper()
+        return call(t, h.VerifyOTP, "/auth/verify-otp", map[string]string{"email": email, "otp": otp})
+    }
+
+    t.Run("requesting a code does not reveal the account", func(t *testing.T) {
+        existingStatus, existingBody := requestOTP(t, "anurag.2428cse2059@kiet.edu")
+        newStatus, newBody := requestOTP(t, "priya.2428cse2060@kiet.edu")
+
+        if existingStatus != 200 || newStatus != 200 {
+            t.Fatalf("statuses = %d and %d, want 200", existingStatus, newStatus)
+        }
+        if !reflect.DeepEqual(existingBody, newBody) {
+            t.Errorf("existing account got %v, new account got %v", existingBody, newBody)
+        }
+        if _, ok := newBody["data_extracted"]; ok {
+            t.Errorf("student details returned before the OTP was verified: %v", newBody)
+        }
+    })
+
+    t.Run("failed verifications look the same", func(t *testing.T) {
+        if status, _ := requestOTP(t, "anurag.2428cse2059@kiet.edu"); status != 200 {
+            t.Fatalf("request OTP status = %d, want 200", status)
+        }
+
+        unknownStatus, unknownBody := verifyOTP(t, "nobody.2428cse9999@kiet.edu", "000000")
+        wrongStatus, wrongBody := verifyOTP(t, "anurag.2428cse2059@kiet.edu", "000000")
+        // MaxAttempts is 1, so this guess throws the challenge away
+        lockedStatus, lockedBody := verifyOTP(t, "anurag.2428cse2059@kiet.edu", "000000")
+
+        if unknownStatus != 401 || wrongStatus != 401 || lockedStatus != 401 {
+            t.Errorf("statuses = %d (unknown account), %d (wrong code), %d (too many attempts), want 401",
+                unknownStatus, wrongStatus, lockedStatus)
+        }
+        if !reflect.DeepEqual(unknownBody, wrongBody) || !reflect.DeepEqual(wrongBody, lockedBody) {
+            t.Errorf("bodies differ: unknown account %v, wrong code %v, too many attempts %v", unknownBody, wrongBody, lockedBody)
+        }
+    })
+}
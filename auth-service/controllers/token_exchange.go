@@ -0,0 +1,161 @@
+package controllers
+
+import (
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+const tokenTypeAccessURN = "urn:ietf:params:oauth:token-type:access_token"
+
+// tokenFromExchange implements RFC 8693 token exchange for services calling
+// other services on a user's behalf. The calling client trades the user's
+// access token for one that:
+//
+//   - only the audience service should accept (aud),
+//   - carries at most the scopes of the original token,
+//   - names the caller in an act claim, nested if the original token was
+//     itself delegated,
+//   - expires no later than the original token.
+func (h *Handler) tokenFromExchange(c *gin.Context) {
+    client, ok := authenticateClient(c)
+    if !ok {
+        return
+    }
+
+    if client.Public || !containsString(client.GrantTypes, models.GrantTokenExchange) {
+        oauthError(c, 400, "unauthorized_client", "This client may not use token exchange")
+        return
+    }
+
+    if c.PostForm("subject_token_type") != tokenTypeAccessURN {
+        oauthError(c, 400, "invalid_request", "subject_token_type must be "+tokenTypeAccessURN)
+        return
+    }
+    if rt := c.PostForm("requested_token_type"); rt != "" && rt != tokenTypeAccessURN {
+        oauthError(c, 400, "invalid_request", "Only access tokens can be requested")
+        return
+    }
+
+    subject, tokenType, active := inspectToken(c.Request.Context(), h.cfg.JWT, c.PostForm("subject_token"), tokenTypeAccess)
+    if !active || tokenType != tokenTypeAccess {
+        oauthError(c, 400, "invalid_grant", "subject_token is invalid or expired")
+        return
+    }
+
+    // A token delegated to some service can only be passed on by that service
+    if !audienceAllows(subject, client.ClientID) {
+        oauthError(c, 400, "invalid_grant", "subject_token was issued for a different audience")
+        return
+    }
+
+    if _, impersonated := subject["impersonator"]; impersonated {
+        oauthError(c, 400, "invalid_grant", "Impersonation tokens cannot be exchanged")
+        return
+    }
+
+    userID, ok := subject["user_id"].(string)
+    if !ok || userID == "" {
+        oauthError(c, 400, "invalid_grant", "subject_token does not belong to a user")
+        return
+    }
+
+    // The subject token may predate a suspension, so check the user as it
+    // is now
+    objID, err := primitive.ObjectIDFromHex(userID)
+    if err != nil {
+        oauthError(c, 400, "invalid_grant", "subject_token does not belong to a user")
+        return
+    }
+    var user models.User
+    err = config.UserCollection.FindOne(c.Request.Context(), bson.M{"_id": objID}).Decode(&user)
+    if err != nil {
+        oauthError(c, 400, "invalid_grant", "User no longer exists")
+        return
+    }
+    if user.Suspended {
+        oauthError(c, 400, "invalid_grant", errAccountSuspended.Error())
+        return
+    }
+
+    // The audience is the downstream service, registered as a client
+    audience := c.PostForm("audience")
+    if audience == "" {
+        oauthError(c, 400, "invalid_target", "audience is required")
+        return
+    }
+    if _, err := findOAuthClient(c.Request.Context(), audience); err != nil {
+        oauthError(c, 400, "invalid_target", "Unknown audience")
+        return
+    }
+
+    // First-party tokens carry no scope and stand for every user scope
+    available := supportedScopes
+    if scope, ok := subject["scope"].(string); ok {
+        available = strings.Fields(scope)
+    }
+
+    scopes := strings.Fields(c.PostForm("scope"))
+    if len(scopes) == 0 {
+        for _, scope := range available {
+            if containsString(client.AllowedScopes, scope) {
+                scopes = append(scopes, scope)
+            }
+        }
+    }
+    for _, scope := range scopes {
+        if !containsString(available, scope) || !containsString(client.AllowedScopes, scope) {
+            oauthError(c, 400, "invalid_scope", "Scope not available for exchange: "+scope)
+            return
+        }
+    }
+    scope := strings.Join(scopes, " ")
+
+    act := map[string]interface{}{"sub": client.ClientID}
+    if previous, ok := subject["act"].(map[string]interface{}); ok {
+        act["act"] = previous
+    }
+
+    ttl := clientTokenTTL(client.AccessTokenTTL, oidcAccessTokenTTL)
+    if exp, err := subject.GetExpirationTime(); err == nil && exp != nil {
+        if remaining := time.Until(exp.Time); remaining < ttl {
+            ttl = remaining
+        }
+    }
+
+    accessToken, err := utils.GenerateDelegatedToken(h.cfg.JWT, userID, client.ClientID, audience, scope, act, ttl)
+    if err != nil {
+        oauthError(c, 500, "server_error", "Failed to generate access token")
+        return
+    }
+
+    c.Header("Cache-Control", "no-store")
+    c.JSON(200, gin.H{
+        "access_token":      accessToken,
+        "issued_token_type": tokenTypeAccessURN,
+        "token_type":        "Bearer",
+        "expires_in":        int(ttl.Seconds()),
+        "scope":             scope,
+    })
+}
+
+// audienceAllows reports whether clientID may present a token with these
+// claims. Tokens without an aud are for anyone; a malformed aud is for no one.
+func audienceAllows(claims jwt.MapClaims, clientID string) bool {
+    if _, ok := claims["aud"]; !ok {
+        return true
+    }
+    audience, err := claims.GetAudience()
+    if err != nil {
+        return false
+    }
+    return containsString(audience, clientID)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+    "testing"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+func TestAudienceAllows(t *testing.T) {
+    tests := []struct {
+        name     string
+        claims   jwt.MapClaims
+        clientID string
+        want     bool
+    }{
+        {"no audience", jwt.MapClaims{"user_id": "u1"}, "service-a", true},
+        {"issued to the caller", jwt.MapClaims{"aud": "service-a"}, "service-a", true},
+        {"issued to another service", jwt.MapClaims{"aud": "service-x"}, "service-a", false},
+        {"caller in an audience list", jwt.MapClaims{"aud": []interface{}{"service-x", "service-a"}}, "service-a", true},
+        {"caller missing from an audience list", jwt.MapClaims{"aud": []interface{}{"service-x", "service-y"}}, "service-a", false},
+        {"empty audience", jwt.MapClaims{"aud": ""}, "service-a", false},
+        {"malformed audience", jwt.MapClaims{"aud": 42}, "service-a", false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := audienceAllows(tt.claims, tt.clientID); got != tt.want {
+                t.Errorf("audienceAllows(%v, %q) = %v, want %v", tt.claims, tt.clientID, got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+)
+
+// LookupUser lets service clients holding users:read fetch a user by ID
+// (GET /api/service/users/:id) or by email (GET /api/service/users?email=)
+func LookupUser(c *gin.Context) {
+    filter := bson.M{}
+    if email := c.Query("email"); email != "" {
+        filter["email"] = email
+    } else {
+        objID, err := primitive.ObjectIDFromHex(c.Param("id"))
+        if err != nil {
+            c.JSON(400, gin.H{
+                "success": false,
+                "error": "Invalid user ID",
+            })
+            return
+        }
+        filter["_id"] = objID
+    }
+
+    var user models.User
+    err := config.UserCollection.FindOne(c.Request.Context(), filter).Decode(&user)
+    if err != nil {
+        if err == mongo.ErrNoDocuments {
+            c.JSON(404, gin.H{
+                "success": false,
+                "error": "User not found",
+            })
+        } else {
+            c.JSON(500, gin.H{
+                "success": false,
+                "error": "Database error",
+            })
+        }
+        return
+    }
+
+    response := userResponse(&user)
+    response["is_verified"] = user.IsVerified
+    c.JSON(200, gin.H{
+        "success": true,
+        "user": response,
+    })
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+    "encoding/base64"
+    "errors"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/services"
+)
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create.
+// Users must already be signed in (usually with an email OTP) to add a passkey.
+// Users with MFA enabled also send a current code or a recovery code.
+func (h *Handler) BeginPasskeyRegistration(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    if !h.requireSecondFactor(c, user) {
+        return
+    }
+
+    options, sessionID, err := h.webauthn.BeginRegistration(c.Request.Context(), user, user.MFAEnabled)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to start passkey registration",
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "session_id": sessionID,
+        "options":    options,
+    })
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response, sent as
+// the raw PublicKeyCredential JSON body, and stores the new passkey.
+// session_id and an optional display name are passed in the query string.
+func (h *Handler) FinishPasskeyRegistration(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    name := c.Query("name")
+    if name == "" {
+        name = "Passkey"
+    }
+
+    credential, err := h.webauthn.FinishRegistration(c.Request.Context(), user, c.Query("session_id"), name, c.Request)
+    if errors.Is(err, services.ErrWebAuthnSecondFactorRequired) {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Start the registration again with your authenticator code",
+        })
+        return
+    }
+    if err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Passkey registration failed",
+            "details": err.Error(),
+        })
+        return
+    }
+
+    _, err = config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{"$push": bson.M{"webauthn_credentials": credential}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to store passkey",
+        })
+        return
+    }
+
+    recordAudit(c, models.AuditPasskeyRegistered, user.ID, gin.H{"credential_id": encodeCredentialID(credential.CredentialID)})
+
+    c.JSON(201, gin.H{
+        "success": true,
+        "message": "Passkey registered",
+        "passkey": passkeyResponse(credential),
+    })
+}
+
+func ListPasskeys(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    passkeys := make([]gin.H, len(user.WebAuthnCredentials))
+    for i := range user.WebAuthnCredentials {
+        passkeys[i] = passkeyResponse(&user.WebAuthnCredentials[i])
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "passkeys": passkeys,
+    })
+}
+
+// DeletePasskey removes one of the user's passkeys. Users with MFA enabled
+// send a current code or a recovery code in the body.
+func (h *Handler) DeletePasskey(c *gin.Context) {
+    user, ok := loadCurrentUser(c)
+    if !ok {
+        return
+    }
+
+    credentialID, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+    if err != nil {
+        c.JSON(400, gin.H{
+            "success": false,
+            "error": "Invalid passkey ID",
+        })
+        return
+    }
+
+    if !h.requireSecondFactor(c, user) {
+        return
+    }
+
+    result, err := config.UserCollection.UpdateOne(
+        c.Request.Context(),
+        bson.M{"_id": user.ID},
+        bson.M{"$pull": bson.M{"webauthn_credentials": bson.M{"credential_id": credentialID}}},
+    )
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to remove passkey",
+        })
+        return
+    }
+    if result.ModifiedCount == 0 {
+        c.JSON(404, gin.H{
+            "success": false,
+            "error": "Passkey not found",
+        })
+        return
+    }
+
+    recordAudit(c, models.AuditPasskeyRemoved, user.ID, gin.H{"credential_id": c.Param("id")})
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "message": "Passkey removed",
+    })
+}
+
+// BeginPasskeyLogin returns the options for navigator.credentials.get. If
+// an email with registered passkeys is given, only those are allowed;
+// otherwise it starts a usernameless login so unknown emails look the same.
+func (h *Handler) BeginPasskeyLogin(c *gin.Context) {
+    var req struct {
+        Email string `json:"email"`
+    }
+    // The body is optional
+    _ = c.ShouldBindJSON(&req)
+
+    // In privacy mode the email is ignored: the credentials we would list
+    // for it reveal that the account exists and has passkeys
+    var user *models.User
+    if req.Email != "" && !h.privacyModeEnabled(c) {
+        var found models.User
+        err := config.UserCollection.FindOne(
+            c.Request.Context(),
+            bson.M{"email": req.Email},
+        ).Decode(&found)
+        if err == nil && len(found.WebAuthnCredentials) > 0 {
+            user = &found
+        }
+    }
+
+    options, sessionID, err := h.webauthn.BeginLogin(c.Request.Context(), user)
+    if err != nil {
+        c.JSON(500, gin.H{
+            "success": false,
+            "error": "Failed to start passkey login",
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "session_id": sessionID,
+        "options":    options,
+    })
+}
+
+// FinishPasskeyLogin verifies the assertion, sent as the raw
+// PublicKeyCredential JSON body with session_id in the query string, and
+// issues the same tokens as VerifyOTP. A passkey that verified the user
+// counts as both factors; otherwise MFA users still get the TOTP step.
+func (h *Handler) FinishPasskeyLogin(c *gin.Context) {
+    user, credential, err := h.webauthn.FinishLogin(c.Request.Context(), c.Query("session_id"), c.Request)
+    if errors.Is(err, services.ErrWebAuthnCloneDetected) {
+        recordAudit(c, models.AuditPasskeyCloneWarning, user.ID, gin.H{"credential_id": encodeCredentialID(credential.CredentialID)})
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "This passkey can't be used. Sign in with an email OTP instead.",
+        })
+        return
+    }
+    if err != nil {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Passkey login failed",
+        })
+        return
+    }
+
+    if !services.PasskeyUserVerified(credential) {
+        h.respondWithLogin(c, user)
+        return
+    }
+
+    accessToken, refreshToken, err := h.completeLogin(c, user)
+    if err != nil {
+        c.JSON(loginErrorStatus(err), gin.H{
+            "success": false,
+            "error": err.Error(),
+        })
+        return
+    }
+
+    c.JSON(200, gin.H{
+        "success": true,
+        "message": "Authentication successful",
+        "access_token":  accessToken,
+        "refresh_token": refreshToken,
+        "user":          userResponse(user),
+    })
+}
+
+// requireSecondFactor makes users with MFA enabled confirm a TOTP code or
+// a recovery code from the JSON body, checked like DisableTOTP does, so a
+// stolen access token alone can't add or remove passkeys. It answers the
+// request itself when the check fails.
+func (h *Handler) requireSecondFactor(c *gin.Context, user *models.User) bool {
+    if !user.MFAEnabled {
+        return true
+    }
+
+    var req struct {
+        Code         string `json:"code"`
+        RecoveryCode string `json:"recovery_code"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "") == (req.RecoveryCode == "") {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "A code from your authenticator app or a recovery code is required",
+            "mfa_required": true,
+        })
+        return false
+    }
+
+    if err := h.checkSecondFactor(c, user, req.Code, req.RecoveryCode); err != nil {
+        respondSecondFactorError(c, err)
+        return false
+    }
+    return true
+}
+
+func passkeyResponse(credential *models.WebAuthnCredential) gin.H {
+    response := gin.H{
+        "id":         encodeCredentialID(credential.CredentialID),
+        "name":       credential.Name,
+        "transports": credential.Transports,
+        "created_at": credential.CreatedAt,
+    }
+    if !credential.LastUsedAt.IsZero() {
+        response["last_used_at"] = credential.LastUsedAt
+    }
+    return response
+}
+
+func encodeCredentialID(id []byte) string {
+    return base64.RawURLEncoding.EncodeToString(id)
+}
@@ -0,0 +1,67 @@
+// Package logging configures the process-wide slog logger to write JSON and
+// carries the request ID through contexts so every line logged while
+// serving a request can be tied back to it.
+package logging
+
+import (
+    "context"
+    "log/slog"
+    "os"
+
+    "go.opentelemetry.io/otel/trace"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+type requestIDKey struct{}
+
+// Init makes slog write JSON to stdout at cfg.Level (debug, info, warn or
+// error). It also becomes the output of the standard log package, so older
+// log.Printf lines come out as JSON too.
+func Init(cfg config.LogConfig) {
+    var level slog.Level
+    if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+        level = slog.LevelInfo
+    }
+
+    handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})
+    slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// WithRequestID returns a copy of ctx carrying id
+func WithRequestID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, if any
+func RequestID(ctx context.Context) string {
+    id, _ := ctx.Value(requestIDKey{}).(string)
+    return id
+}
+
+// contextHandler adds the request ID and trace IDs from the context passed
+// to slog's *Context functions
+type contextHandler struct {
+    slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+    if id := RequestID(ctx); id != "" {
+        r.AddAttrs(slog.String("request_id", id))
+    }
+    if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+        r.AddAttrs(
+            slog.String("trace_id", sc.TraceID().String()),
+            slog.String("span_id", sc.SpanID().String()),
+        )
+    }
+    return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+    return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -7,56 +7,117 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/Anurag-spec1/goauthenticate/config"
+	"github.com/Anurag-spec1/goauthenticate/controllers"
+	"github.com/Anurag-spec1/goauthenticate/logging"
+	"github.com/Anurag-spec1/goauthenticate/metrics"
+	"github.com/Anurag-spec1/goauthenticate/middleware"
+	"github.com/Anurag-spec1/goauthenticate/migrations"
+	"github.com/Anurag-spec1/goauthenticate/ratelimit"
 	"github.com/Anurag-spec1/goauthenticate/routes"
+	"github.com/Anurag-spec1/goauthenticate/services"
+	"github.com/Anurag-spec1/goauthenticate/tracing"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-    // Load environment variables
-    if err := godotenv.Load(); err != nil {
-        log.Println("No .env file found, using system environment variables")
+    // Load configuration (.env, CONFIG_FILE, environment) and stop on any
+    // problem with it
+    cfg, err := config.Load()
+    if err != nil {
+        log.Fatalf("Invalid configuration:\n%v", err)
     }
+    logging.Init(cfg.Log)
 
-    // Set Gin mode
-    if os.Getenv("GIN_MODE") == "release" {
-        gin.SetMode(gin.ReleaseMode)
+    gin.SetMode(cfg.Server.GinMode)
+
+    // "goauthenticate migrate ..." manages the schema and exits
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        os.Exit(runMigrate(cfg, os.Args[2:]))
+    }
+
+    // Set up tracing before anything that starts spans
+    shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing.ServiceName, cfg.Tracing.Exporter, cfg.Tracing.OTLPEndpoint)
+    if err != nil {
+        log.Fatal("Failed to set up tracing:", err)
     }
 
     // Connect to MongoDB
-    config.ConnectDB()
+    config.ConnectDB(cfg.Mongo)
     defer config.DisconnectDB()
 
-    // Setup Gin router with middleware
-    r := gin.Default()
-    
-    // Add CORS middleware for development
-    r.Use(func(c *gin.Context) {
-        c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-        c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-        c.Writer.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-        
-        if c.Request.Method == "OPTIONS" {
-            c.AbortWithStatus(204)
-            return
+    // Bring the schema up to date. Instances starting together take turns
+    // rather than migrating twice.
+    migrator := migrations.NewMigrator(config.DB)
+    if cfg.Mongo.AutoMigrate {
+        if _, err := migrator.Up(context.Background(), 0, false); err != nil {
+            log.Fatal("Failed to migrate database:", err)
         }
-        
-        c.Next()
+    } else if pending, err := migrator.Up(context.Background(), 0, true); err == nil && len(pending) > 0 {
+        log.Printf("Warning: %d database migrations pending, run \"goauthenticate migrate\"", len(pending))
+    }
+
+    // Setup Gin router with middleware. Access logs come from our own
+    // middleware, as JSON carrying the request ID.
+    r := gin.New()
+
+    // We resolve the client IP ourselves from the trusted proxies, so Gin
+    // must not believe forwarding headers on its own
+    if err := r.SetTrustedProxies(nil); err != nil {
+        log.Fatal("Failed to configure trusted proxies:", err)
+    }
+    r.Use(middleware.RequestID())
+    r.Use(tracing.Middleware(cfg.Tracing.ServiceName))
+    r.Use(middleware.RealIP(middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)))
+    r.Use(middleware.AccessLog())
+    r.Use(metrics.Middleware())
+    r.Use(gin.Recovery())
+    r.Use(middleware.CORS(cfg.CORS))
+
+    // Services are built once and shared by every request
+    webAuthn, err := services.NewWebAuthnService(cfg.WebAuthn)
+    if err != nil {
+        log.Fatal("Failed to set up passkeys:", err)
+    }
+    handler := controllers.NewHandler(cfg, controllers.Services{
+        OTP:       services.NewOTPService(cfg.JWT),
+        Email:     services.NewEmailService(cfg.Email),
+        Templates: services.DefaultEmailTemplates(cfg.Email),
+        Challenge: services.NewChallengeService(cfg.Challenge, cfg.JWT, services.NewCaptchaVerifier(cfg.Challenge)),
+        WebAuthn:  webAuthn,
+
+        OTPVolume:      ratelimit.New(cfg.RateLimit, "otp-risk-global", ratelimit.Rate{Limit: cfg.Challenge.Threshold, Window: time.Minute}),
+        EmailOTPVolume: ratelimit.New(cfg.RateLimit, "otp-risk-email", ratelimit.Rate{Limit: cfg.Challenge.EmailThreshold, Window: cfg.Challenge.EmailWindow.Std()}),
     })
 
     // Register routes
-    routes.RegisterAuthRoutes(r)
+    routes.RegisterAuthRoutes(r, cfg, handler)
+    routes.RegisterOAuthRoutes(r, cfg, handler)
+    routes.RegisterAdminRoutes(r, cfg, handler)
 
-    // Start server
-    port := os.Getenv("PORT")
-    if port == "" {
-        port = "8080"
+    // Metrics go on their own listener when metrics_addr is set (e.g.
+    // ":9090"), so they can be kept off the public port
+    metricsAddr := cfg.Server.MetricsAddr
+    if metricsAddr == "" {
+        r.GET("/metrics", gin.WrapH(metrics.Handler()))
+    } else {
+        mux := http.NewServeMux()
+        mux.Handle("/metrics", metrics.Handler())
+        go func() {
+            fmt.Printf("📈 Metrics on http://localhost%s/metrics\n", metricsAddr)
+            if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+                log.Fatalf("Failed to start metrics server: %v", err)
+            }
+        }()
     }
 
+    // Start server
+    port := strconv.Itoa(cfg.Server.Port)
+
     // Graceful shutdown
     srv := &http.Server{
         Addr:    ":" + port,
@@ -77,15 +138,28 @@ func main() {
     quit := make(chan os.Signal, 1)
     signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
     <-quit
+
+    // Fail readiness first and give load balancers time to notice before
+    // the listener closes
+    controllers.StartDraining()
+    drainDelay := cfg.Server.ShutdownDrainDelay.Std()
+    log.Printf("Draining for %s before shutting down...", drainDelay)
+    time.Sleep(drainDelay)
+
     log.Println("Shutting down server...")
 
-    // Give server 5 seconds to finish current requests
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    // Give the server a bounded time to finish current requests
+    ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Std())
     defer cancel()
     
     if err := srv.Shutdown(ctx); err != nil {
         log.Fatal("Server forced to shutdown:", err)
     }
+
+    // Flush spans still waiting to be exported
+    if err := shutdownTracing(ctx); err != nil {
+        log.Println("Error shutting down tracing:", err)
+    }
     
     log.Println("Server exited properly")
 }
\ No newline at end of file
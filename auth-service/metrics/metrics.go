@@ -0,0 +1,128 @@
+// Package metrics holds the Prometheus collectors for the service and the
+// handler that exposes them.
+package metrics
+
+import (
+    "context"
+    "net/http"
+    "strconv"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/collectors"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "go.mongodb.org/mongo-driver/event"
+)
+
+const namespace = "goauth"
+
+// Registry is separate from the Prometheus default one so only what is
+// defined here (plus Go and process stats) gets exported
+var Registry = prometheus.NewRegistry()
+
+var (
+    HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "http_requests_total",
+        Help:      "HTTP requests by route, method and status code.",
+    }, []string{"route", "method", "status"})
+
+    HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "http_request_duration_seconds",
+        Help:      "HTTP request latency by route and method.",
+        Buckets:   prometheus.DefBuckets,
+    }, []string{"route", "method"})
+
+    OTPRequested = prometheus.NewCounter(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "otp_requested_total",
+        Help:      "OTPs issued by RequestOTP.",
+    })
+
+    // OTPVerifications is labelled "verified", "invalid", "unknown_user" or
+    // "too_many_attempts"
+    OTPVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "otp_verifications_total",
+        Help:      "OTP verification attempts by result.",
+    }, []string{"result"})
+
+    // EmailSends is labelled with the provider that was tried and "sent"
+    // or "failed". A failed Resend send is also counted as a simulation.
+    EmailSends = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "email_sends_total",
+        Help:      "Email send attempts by provider and outcome.",
+    }, []string{"provider", "outcome"})
+
+    EmailDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "email_send_duration_seconds",
+        Help:      "Time spent calling the email provider.",
+        Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+    }, []string{"provider"})
+
+    TokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Namespace: namespace,
+        Name:      "tokens_issued_total",
+        Help:      "Tokens issued by type.",
+    }, []string{"type"})
+
+    MongoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Namespace: namespace,
+        Name:      "mongo_command_duration_seconds",
+        Help:      "MongoDB command latency by command and outcome.",
+        Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+    }, []string{"command", "outcome"})
+)
+
+func init() {
+    Registry.MustRegister(
+        collectors.NewGoCollector(),
+        collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+        HTTPRequests,
+        HTTPDuration,
+        OTPRequested,
+        OTPVerifications,
+        EmailSends,
+        EmailDuration,
+        TokensIssued,
+        MongoDuration,
+    )
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+    return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts and times every request. Routes are labelled with
+// their pattern, not the raw path, so IDs in URLs don't explode the
+// series count.
+func Middleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+        c.Next()
+
+        route := c.FullPath()
+        if route == "" {
+            route = "unmatched"
+        }
+        HTTPRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+        HTTPDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+    }
+}
+
+// MongoMonitor times every command the driver runs
+func MongoMonitor() *event.CommandMonitor {
+    return &event.CommandMonitor{
+        Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+            MongoDuration.WithLabelValues(e.CommandName, "success").Observe(e.Duration.Seconds())
+        },
+        Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+            MongoDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+        },
+    }
+}
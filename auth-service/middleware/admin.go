@@ -0,0 +1,42 @@
+package middleware
+
+import (
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/services"
+)
+
+// AdminMiddleware must run after AuthMiddleware and lets through users that
+// services.IsAdmin accepts. Pair it with FirstPartyOnly so tokens issued to
+// OAuth clients never act as admin.
+func AdminMiddleware(cfg config.AdminConfig) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, _ := c.Get("user_id")
+        objID, err := primitive.ObjectIDFromHex(userID.(string))
+        if err != nil {
+            c.JSON(401, gin.H{
+                "success": false,
+                "error": "Invalid user ID",
+            })
+            c.Abort()
+            return
+        }
+
+        var user models.User
+        err = config.UserCollection.FindOne(c.Request.Context(), bson.M{"_id": objID}).Decode(&user)
+        if err != nil || !services.IsAdmin(cfg, &user) {
+            c.JSON(403, gin.H{
+                "success": false,
+                "error": "Admin access required",
+            })
+            c.Abort()
+            return
+        }
+
+        c.Next()
+    }
+}
@@ -4,69 +4,299 @@ import (
     "strings"
     "github.com/gin-gonic/gin"
     "github.com/golang-jwt/jwt/v5"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/services"
     "github.com/Anurag-spec1/goauthenticate/utils"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// Subject types set in the context under "subject_type"
+const (
+    SubjectUser   = "user"
+    SubjectClient = "client"
+)
+
+// AuthMiddleware accepts access tokens that belong to a user
+func AuthMiddleware(cfg config.JWTConfig) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if authenticate(c, cfg, true, false) {
+            c.Next()
+        }
+    }
+}
+
+// ClientAuthMiddleware accepts service tokens from the client_credentials
+// grant, which have a client but no user
+func ClientAuthMiddleware(cfg config.JWTConfig) gin.HandlerFunc {
     return func(c *gin.Context) {
-        token := c.GetHeader("Authorization")
-        if token == "" {
+        if authenticate(c, cfg, false, true) {
+            c.Next()
+        }
+    }
+}
+
+// AnyAuthMiddleware accepts both user and service tokens. Handlers can tell
+// them apart with c.GetString("subject_type").
+func AnyAuthMiddleware(cfg config.JWTConfig) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if authenticate(c, cfg, true, true) {
+            c.Next()
+        }
+    }
+}
+
+// authenticate validates the bearer token and fills the context. It aborts
+// the request and returns false if the token is missing, invalid or of a
+// subject type the route does not accept.
+func authenticate(c *gin.Context, cfg config.JWTConfig, allowUsers, allowClients bool) bool {
+    token := c.GetHeader("Authorization")
+    if token == "" {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Authorization header is required",
+        })
+        c.Abort()
+        return false
+    }
+
+    // Remove "Bearer " prefix
+    token = strings.TrimPrefix(token, "Bearer ")
+    token = strings.TrimSpace(token)
+
+    if token == "" {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Token is empty",
+        })
+        c.Abort()
+        return false
+    }
+
+    // Parse and validate token
+    parsedToken, err := utils.ParseToken(cfg, token, false)
+    if err != nil || !parsedToken.Valid {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid or expired token",
+        })
+        c.Abort()
+        return false
+    }
+
+    // Extract claims
+    claims, ok := parsedToken.Claims.(jwt.MapClaims)
+    if !ok {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid token claims",
+        })
+        c.Abort()
+        return false
+    }
+
+    // Only access tokens may be used here; refresh, magic link and
+    // partial MFA tokens all carry a different type
+    if claims["type"] != "access" {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Invalid token type",
+        })
+        c.Abort()
+        return false
+    }
+
+    // Exchanged tokens are meant for the downstream service named in aud,
+    // not for our own API
+    if _, ok := claims["aud"]; ok {
+        c.JSON(401, gin.H{
+            "success": false,
+            "error": "Token is intended for another service",
+        })
+        c.Abort()
+        return false
+    }
+
+    // Revoked tokens are refused until they expire. If the denylist
+    // cannot be checked we fail closed.
+    if jti, ok := claims["jti"].(string); ok {
+        revoked, err := services.NewRevocationService().IsRevoked(c.Request.Context(), jti)
+        if err != nil {
+            c.JSON(503, gin.H{
+                "success": false,
+                "error": "Could not verify token",
+            })
+            c.Abort()
+            return false
+        }
+        if revoked {
             c.JSON(401, gin.H{
                 "success": false,
-                "error": "Authorization header is required",
+                "error": "Token has been revoked",
             })
             c.Abort()
-            return
+            return false
         }
+    }
 
-        // Remove "Bearer " prefix
-        token = strings.TrimPrefix(token, "Bearer ")
-        token = strings.TrimSpace(token)
+    subjectType := SubjectUser
+    if claims["subject_type"] == SubjectClient {
+        subjectType = SubjectClient
+    }
 
-        if token == "" {
+    if (subjectType == SubjectUser && !allowUsers) || (subjectType == SubjectClient && !allowClients) {
+        c.JSON(403, gin.H{
+            "success": false,
+            "error": "This endpoint does not accept " + subjectType + " tokens",
+        })
+        c.Abort()
+        return false
+    }
+
+    if subjectType == SubjectUser {
+        // Get user ID from claims
+        userID, ok := claims["user_id"].(string)
+        if !ok || userID == "" {
             c.JSON(401, gin.H{
                 "success": false,
-                "error": "Token is empty",
+                "error": "Invalid user ID in token",
             })
             c.Abort()
-            return
+            return false
         }
 
-        // Parse and validate token
-        parsedToken, err := utils.ParseToken(token, false)
-        if err != nil || !parsedToken.Valid {
-            c.JSON(401, gin.H{
+        // Access tokens outlive a suspension, so check the user as it is
+        // now. As with the denylist, fail closed if we cannot tell.
+        suspended, err := userSuspended(c, userID)
+        if err != nil {
+            c.JSON(503, gin.H{
                 "success": false,
-                "error": "Invalid or expired token",
+                "error": "Could not verify token",
             })
             c.Abort()
+            return false
+        }
+        if suspended {
+            c.JSON(403, gin.H{
+                "success": false,
+                "error": "Account suspended",
+            })
+            c.Abort()
+            return false
+        }
+
+        // Set user ID in context for use in controllers
+        c.Set("user_id", userID)
+    }
+    c.Set("subject_type", subjectType)
+
+    // Tokens issued to OAuth clients are limited to the scopes granted
+    if clientID, ok := claims["client_id"].(string); ok {
+        c.Set("client_id", clientID)
+    }
+    if scope, ok := claims["scope"].(string); ok {
+        c.Set("scope", scope)
+    }
+
+    // An admin acting as this user
+    if impersonator, ok := claims["impersonator"].(string); ok {
+        c.Set("impersonator", impersonator)
+    }
+    return true
+}
+
+// userSuspended reports whether the user behind a token has been suspended.
+// A user that no longer exists counts as suspended: their tokens must stop
+// working just the same.
+func userSuspended(c *gin.Context, userID string) (bool, error) {
+    objID, err := primitive.ObjectIDFromHex(userID)
+    if err != nil {
+        return true, nil
+    }
+
+    var user struct {
+        Suspended bool `bson:"suspended"`
+    }
+    err = config.UserCollection.FindOne(
+        c.Request.Context(),
+        bson.M{"_id": objID},
+        options.FindOne().SetProjection(bson.M{"suspended": 1}),
+    ).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        return true, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return user.Suspended, nil
+}
+
+// RequireScope rejects tokens issued to OAuth clients unless they were
+// granted every listed scope. First-party tokens from our own login flow
+// carry no scope and are allowed through.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        granted, restricted := c.Get("scope")
+        if !restricted {
+            c.Next()
             return
         }
 
-        // Extract claims
-        claims, ok := parsedToken.Claims.(jwt.MapClaims)
-        if !ok {
-            c.JSON(401, gin.H{
+        have := strings.Fields(granted.(string))
+        for _, scope := range scopes {
+            found := false
+            for _, h := range have {
+                if h == scope {
+                    found = true
+                    break
+                }
+            }
+            if !found {
+                c.JSON(403, gin.H{
+                    "success": false,
+                    "error": "Token is missing the required scope: " + scope,
+                })
+                c.Abort()
+                return
+            }
+        }
+
+        c.Next()
+    }
+}
+
+// FirstPartyOnly rejects tokens issued to OAuth clients, for routes that
+// manage the account itself and must never be reachable by third parties
+func FirstPartyOnly() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        if _, isClientToken := c.Get("client_id"); isClientToken {
+            c.JSON(403, gin.H{
                 "success": false,
-                "error": "Invalid token claims",
+                "error": "This endpoint cannot be used with a client token",
             })
             c.Abort()
             return
         }
+        c.Next()
+    }
+}
 
-        // Get user ID from claims
-        userID, ok := claims["user_id"].(string)
-        if !ok || userID == "" {
-            c.JSON(401, gin.H{
+// BlockImpersonation lets impersonation tokens read but not change
+// anything, so support staff cannot act for the student
+func BlockImpersonation() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        _, impersonating := c.Get("impersonator")
+        safe := c.Request.Method == "GET" || c.Request.Method == "HEAD" || c.Request.Method == "OPTIONS"
+        if impersonating && !safe {
+            c.JSON(403, gin.H{
                 "success": false,
-                "error": "Invalid user ID in token",
+                "error": "Not allowed while impersonating a user",
             })
             c.Abort()
             return
         }
-
-        // Set user ID in context for use in controllers
-        c.Set("user_id", userID)
         c.Next()
     }
-}
\ No newline at end of file
+}
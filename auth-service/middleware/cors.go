@@ -0,0 +1,51 @@
+package middleware
+
+import (
+    "strings"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+// CORS answers preflight requests and sets the CORS headers. An allowed
+// origin of "*" lets any site call the API; otherwise the request's Origin
+// is echoed back only when it is in the list.
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+    allowAny := false
+    allowed := map[string]bool{}
+    for _, origin := range cfg.AllowedOrigins {
+        if origin == "*" {
+            allowAny = true
+        }
+        allowed[origin] = true
+    }
+
+    methods := strings.Join(cfg.AllowedMethods, ", ")
+    headers := strings.Join(cfg.AllowedHeaders, ", ")
+    exposed := strings.Join(cfg.ExposedHeaders, ", ")
+
+    return func(c *gin.Context) {
+        h := c.Writer.Header()
+        if allowAny {
+            h.Set("Access-Control-Allow-Origin", "*")
+        } else {
+            h.Add("Vary", "Origin")
+            if origin := c.GetHeader("Origin"); allowed[origin] {
+                h.Set("Access-Control-Allow-Origin", origin)
+            }
+        }
+        h.Set("Access-Control-Allow-Methods", methods)
+        h.Set("Access-Control-Allow-Headers", headers)
+        if exposed != "" {
+            h.Set("Access-Control-Expose-Headers", exposed)
+        }
+
+        if c.Request.Method == "OPTIONS" {
+            c.AbortWithStatus(204)
+            return
+        }
+
+        c.Next()
+    }
+}
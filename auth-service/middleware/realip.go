@@ -0,0 +1,135 @@
+package middleware
+
+import (
+    "net"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// ParseTrustedProxies parses CIDRs or single IPs (e.g. "10.0.0.0/8",
+// "192.168.1.10"). An empty list means no proxy is trusted and forwarding
+// headers are ignored.
+func ParseTrustedProxies(entries []string) []*net.IPNet {
+    var trusted []*net.IPNet
+    for _, entry := range entries {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+
+        if !strings.Contains(entry, "/") {
+            if ip := net.ParseIP(entry); ip != nil {
+                bits := 128
+                if ip.To4() != nil {
+                    ip, bits = ip.To4(), 32
+                }
+                trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+                continue
+            }
+        }
+
+        // config.Validate has already rejected anything unparseable
+        _, network, err := net.ParseCIDR(entry)
+        if err != nil {
+            continue
+        }
+        trusted = append(trusted, network)
+    }
+    return trusted
+}
+
+// RealIP resolves the client's address once per request and stores it for
+// ClientIP. Forwarding headers (Forwarded, then X-Forwarded-For, then
+// X-Real-IP) are only believed when the request comes from a trusted
+// proxy, and the chain is walked from the right so a client cannot
+// prepend a fake address.
+func RealIP(trusted []*net.IPNet) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Set("client_ip", resolveClientIP(c, trusted))
+        c.Next()
+    }
+}
+
+// ClientIP returns the address RealIP resolved, or the direct peer if
+// RealIP did not run. Use it instead of gin's c.ClientIP.
+func ClientIP(c *gin.Context) string {
+    if ip := c.GetString("client_ip"); ip != "" {
+        return ip
+    }
+    return c.RemoteIP()
+}
+
+func resolveClientIP(c *gin.Context, trusted []*net.IPNet) string {
+    remote := net.ParseIP(c.RemoteIP())
+    if remote == nil {
+        return c.RemoteIP()
+    }
+    if !isTrustedProxy(remote, trusted) {
+        return remote.String()
+    }
+
+    var hops []string
+    if forwarded := c.Request.Header.Values("Forwarded"); len(forwarded) > 0 {
+        hops = forwardedFor(forwarded)
+    } else if xff := c.Request.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+        for _, line := range xff {
+            hops = append(hops, strings.Split(line, ",")...)
+        }
+    } else if realIP := c.GetHeader("X-Real-IP"); realIP != "" {
+        hops = []string{realIP}
+    }
+
+    // The rightmost address that is not one of our proxies is the client.
+    // An unparsable hop ends the walk at the last address we could trust.
+    client := remote
+    for i := len(hops) - 1; i >= 0; i-- {
+        ip := parseHop(hops[i])
+        if ip == nil {
+            break
+        }
+        client = ip
+        if !isTrustedProxy(ip, trusted) {
+            break
+        }
+    }
+    return client.String()
+}
+
+// forwardedFor extracts the for= values from RFC 7239 Forwarded headers
+func forwardedFor(headers []string) []string {
+    var hops []string
+    for _, header := range headers {
+        for _, element := range strings.Split(header, ",") {
+            hop := ""
+            for _, pair := range strings.Split(element, ";") {
+                key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+                if ok && strings.EqualFold(key, "for") {
+                    hop = strings.Trim(value, `"`)
+                }
+            }
+            hops = append(hops, hop)
+        }
+    }
+    return hops
+}
+
+// parseHop accepts "ip", "ip:port", "[ipv6]" and "[ipv6]:port". Obfuscated
+// identifiers and "unknown" return nil.
+func parseHop(hop string) net.IP {
+    hop = strings.TrimSpace(hop)
+    if host, _, err := net.SplitHostPort(hop); err == nil {
+        hop = host
+    }
+    hop = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+    return net.ParseIP(hop)
+}
+
+func isTrustedProxy(ip net.IP, trusted []*net.IPNet) bool {
+    for _, network := range trusted {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+    "bytes"
+    "log/slog"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/Anurag-spec1/goauthenticate/logging"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Incoming IDs end up in logs, so only plain ones are accepted
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID takes the caller's X-Request-ID, or makes one up, and puts it
+// in the request context, the response headers and the body of every JSON
+// error response
+func RequestID() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        id := c.GetHeader(RequestIDHeader)
+        if !validRequestID.MatchString(id) {
+            generated, err := utils.GenerateSecureToken(16)
+            if err != nil {
+                c.AbortWithStatus(500)
+                return
+            }
+            id = generated
+        }
+
+        c.Set("request_id", id)
+        c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+        c.Header(RequestIDHeader, id)
+        c.Writer = &requestIDWriter{ResponseWriter: c.Writer, field: `"request_id":` + strconv.Quote(id)}
+
+        c.Next()
+    }
+}
+
+// requestIDWriter adds a request_id field to JSON object bodies written
+// with an error status. Handlers render each JSON body in a single Write.
+type requestIDWriter struct {
+    gin.ResponseWriter
+    field string
+}
+
+func (w *requestIDWriter) Write(b []byte) (int, error) {
+    if w.Status() < 400 || len(b) < 2 || b[0] != '{' ||
+        !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+        return w.ResponseWriter.Write(b)
+    }
+
+    body := make([]byte, 0, len(b)+len(w.field)+1)
+    body = append(body, '{')
+    body = append(body, w.field...)
+    if !bytes.Equal(bytes.TrimSpace(b[1:]), []byte("}")) {
+        body = append(body, ',')
+    }
+    body = append(body, b[1:]...)
+
+    if _, err := w.ResponseWriter.Write(body); err != nil {
+        return 0, err
+    }
+    return len(b), nil
+}
+
+// AccessLog writes one JSON line per request, with the caller's user or
+// client ID when the request was authenticated
+func AccessLog() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+        c.Next()
+
+        attrs := []slog.Attr{
+            slog.String("method", c.Request.Method),
+            slog.String("path", c.Request.URL.Path),
+            slog.String("route", c.FullPath()),
+            slog.Int("status", c.Writer.Status()),
+            slog.Int("bytes", c.Writer.Size()),
+            slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+            slog.String("client_ip", ClientIP(c)),
+            slog.String("user_agent", c.Request.UserAgent()),
+        }
+        if userID := c.GetString("user_id"); userID != "" {
+            attrs = append(attrs, slog.String("user_id", userID))
+        }
+        if clientID := c.GetString("client_id"); clientID != "" {
+            attrs = append(attrs, slog.String("client_id", clientID))
+        }
+        if impersonator := c.GetString("impersonator"); impersonator != "" {
+            attrs = append(attrs, slog.String("impersonator", impersonator))
+        }
+        if len(c.Errors) > 0 {
+            attrs = append(attrs, slog.String("errors", c.Errors.String()))
+        }
+
+        level := slog.LevelInfo
+        if c.Writer.Status() >= 500 {
+            level = slog.LevelError
+        }
+        slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+    }
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/Anurag-spec1/goauthenticate/config"
+	"github.com/Anurag-spec1/goauthenticate/migrations"
+)
+
+// runMigrate implements the migrate subcommand and returns the exit code.
+// It runs the same command as "goauthctl migrate", defaulting to "up".
+func runMigrate(cfg *config.Config, args []string) int {
+    if len(args) == 0 || (args[0] != "-h" && args[0] != "--help" && args[0][0] == '-') {
+        args = append([]string{"up"}, args...)
+    }
+
+    connected := false
+    cmd := migrations.Command(func() *mongo.Database {
+        config.ConnectDB(cfg.Mongo)
+        connected = true
+        return config.DB
+    })
+    root := &cobra.Command{
+        Use:           "goauthenticate",
+        SilenceUsage:  true,
+        SilenceErrors: true,
+    }
+    root.CompletionOptions.DisableDefaultCmd = true
+    root.AddCommand(cmd)
+    root.SetArgs(append([]string{"migrate"}, args...))
+
+    err := root.Execute()
+    if connected {
+        config.DisconnectDB()
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Error:", err)
+        return 1
+    }
+    return 0
+}
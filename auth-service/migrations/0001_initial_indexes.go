@@ -0,0 +1,105 @@
+package migrations
+
+import (
+    "context"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The indexes the server used to create at startup. Databases that already
+// have them are left as they are.
+func init() {
+    register(Migration{
+        Version:     1,
+        Description: "initial indexes",
+        Up: func(ctx context.Context, db *mongo.Database) error {
+            // Create unique index on email
+            err := createIndexes(ctx, db.Collection("users"), mongo.IndexModel{
+                Keys:    bson.D{{Key: "email", Value: 1}},
+                Options: options.Index().SetUnique(true).SetName("unique_email"),
+            })
+            if err != nil {
+                return err
+            }
+
+            // Audit trail is queried per user, newest first
+            err = createIndexes(ctx, db.Collection("audit_events"), mongo.IndexModel{
+                Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+                Options: options.Index().SetName("audit_user_time"),
+            })
+            if err != nil {
+                return err
+            }
+
+            // OIDC provider
+            err = createIndexes(ctx, db.Collection("oauth_clients"), mongo.IndexModel{
+                Keys:    bson.D{{Key: "client_id", Value: 1}},
+                Options: options.Index().SetUnique(true).SetName("unique_client_id"),
+            })
+            if err != nil {
+                return err
+            }
+
+            // Abandoned passkey ceremonies, authorization requests, codes,
+            // revocations and rate limit windows expire on their own
+            err = createIndexes(ctx, db.Collection("webauthn_sessions"), mongo.IndexModel{
+                Keys:    bson.D{{Key: "expires_at", Value: 1}},
+                Options: options.Index().SetExpireAfterSeconds(0).SetName("webauthn_session_expiry"),
+            })
+            if err != nil {
+                return err
+            }
+            for _, name := range expiringCollections {
+                err := createIndexes(ctx, db.Collection(name), mongo.IndexModel{
+                    Keys:    bson.D{{Key: "expires_at", Value: 1}},
+                    Options: options.Index().SetExpireAfterSeconds(0).SetName("expiry"),
+                })
+                if err != nil {
+                    return err
+                }
+            }
+
+            // Users type the user code, so it is how device authorizations are found
+            return createIndexes(ctx, db.Collection("device_authorizations"), mongo.IndexModel{
+                Keys:    bson.D{{Key: "user_code", Value: 1}},
+                Options: options.Index().SetUnique(true).SetName("unique_user_code"),
+            })
+        },
+        Down: func(ctx context.Context, db *mongo.Database) error {
+            drops := []struct {
+                collection string
+                index      string
+            }{
+                {"users", "unique_email"},
+                {"audit_events", "audit_user_time"},
+                {"oauth_clients", "unique_client_id"},
+                {"webauthn_sessions", "webauthn_session_expiry"},
+                {"device_authorizations", "unique_user_code"},
+            }
+            for _, name := range expiringCollections {
+                drops = append(drops, struct {
+                    collection string
+                    index      string
+                }{name, "expiry"})
+            }
+
+            for _, drop := range drops {
+                if err := dropIndexes(ctx, db.Collection(drop.collection), drop.index); err != nil {
+                    return err
+                }
+            }
+            return nil
+        },
+    })
+}
+
+// Collections whose documents carry their own expires_at
+var expiringCollections = []string{
+    "oauth_authorization_requests",
+    "oauth_codes",
+    "device_authorizations",
+    "revoked_tokens",
+    "rate_limits",
+}
@@ -0,0 +1,60 @@
+package migrations
+
+import (
+    "context"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OTPs moved out of user documents into otp_challenges. The old otp_expiry
+// TTL index on users deleted the whole user ten minutes after each code was
+// issued, so it goes first. Codes still pending in the old fields are
+// dropped; users just request another.
+func init() {
+    register(Migration{
+        Version:     2,
+        Description: "move OTPs to otp_challenges",
+        Up: func(ctx context.Context, db *mongo.Database) error {
+            users := db.Collection("users")
+            if err := dropIndexes(ctx, users, "otp_expiry"); err != nil {
+                return err
+            }
+
+            _, err := users.UpdateMany(ctx,
+                bson.M{"$or": bson.A{
+                    bson.M{"otp": bson.M{"$exists": true}},
+                    bson.M{"otp_expires_at": bson.M{"$exists": true}},
+                    bson.M{"otp_attempts": bson.M{"$exists": true}},
+                    bson.M{"magic_link_nonce": bson.M{"$exists": true}},
+                }},
+                bson.M{"$unset": bson.M{
+                    "otp":              "",
+                    "otp_expires_at":   "",
+                    "otp_attempts":     "",
+                    "magic_link_nonce": "",
+                }},
+            )
+            if err != nil {
+                return err
+            }
+
+            // One pending code per user and purpose, removed once it expires
+            return createIndexes(ctx, db.Collection("otp_challenges"),
+                mongo.IndexModel{
+                    Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}},
+                    Options: options.Index().SetUnique(true).SetName("unique_user_purpose"),
+                },
+                mongo.IndexModel{
+                    Keys:    bson.D{{Key: "expires_at", Value: 1}},
+                    Options: options.Index().SetExpireAfterSeconds(0).SetName("expiry"),
+                },
+            )
+        },
+        // The users TTL index is deliberately not put back
+        Down: func(ctx context.Context, db *mongo.Database) error {
+            return db.Collection("otp_challenges").Drop(ctx)
+        },
+    })
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import (
+    "context"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Solved proof-of-work challenges are recorded so each one is accepted only
+// once. The records are only needed until the challenge would have expired.
+func init() {
+    register(Migration{
+        Version:     3,
+        Description: "expire redeemed challenges",
+        Up: func(ctx context.Context, db *mongo.Database) error {
+            return createIndexes(ctx, db.Collection("redeemed_challenges"), mongo.IndexModel{
+                Keys:    bson.D{{Key: "expires_at", Value: 1}},
+                Options: options.Index().SetExpireAfterSeconds(0).SetName("expiry"),
+            })
+        },
+        Down: func(ctx context.Context, db *mongo.Database) error {
+            return db.Collection("redeemed_challenges").Drop(ctx)
+        },
+    })
+}
@@ -0,0 +1,104 @@
+package migrations
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "text/tabwriter"
+    "time"
+
+    "github.com/spf13/cobra"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// Reading the status gets this long before it is abandoned. Applying and
+// rolling back take as long as they take.
+const statusTimeout = time.Minute
+
+// Command returns the "migrate" command shared by "goauthenticate migrate"
+// and "goauthctl migrate". connect is called before the database is first
+// used and returns it.
+func Command(connect func() *mongo.Database) *cobra.Command {
+    var upTo, downTo int
+    var dryRun bool
+
+    cmd := &cobra.Command{
+        Use:   "migrate",
+        Short: "Apply, roll back and list database migrations",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return cmd.Help()
+        },
+    }
+
+    up := &cobra.Command{
+        Use:   "up",
+        Short: "Apply pending migrations",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            done, err := NewMigrator(connect()).Up(cmd.Context(), upTo, dryRun)
+            return report(cmd.OutOrStdout(), done, err, dryRun, "Applied", "Would apply")
+        },
+    }
+    up.Flags().IntVar(&upTo, "to", 0, "last version to apply (default all)")
+
+    down := &cobra.Command{
+        Use:   "down",
+        Short: "Roll back applied migrations",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            done, err := NewMigrator(connect()).Down(cmd.Context(), downTo, dryRun)
+            return report(cmd.OutOrStdout(), done, err, dryRun, "Rolled back", "Would roll back")
+        },
+    }
+    down.Flags().IntVar(&downTo, "to", -1, "version to roll back to; -1 rolls back only the latest")
+
+    status := &cobra.Command{
+        Use:   "status",
+        Short: "List migrations and whether they are applied",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx, cancel := context.WithTimeout(cmd.Context(), statusTimeout)
+            defer cancel()
+
+            statuses, err := NewMigrator(connect()).Status(ctx)
+            if err != nil {
+                return err
+            }
+            return writeStatus(cmd.OutOrStdout(), statuses)
+        },
+    }
+
+    for _, sub := range []*cobra.Command{up, down} {
+        sub.Flags().BoolVar(&dryRun, "dry-run", false, "show what would run without changing anything")
+    }
+    cmd.AddCommand(up, down, status)
+    return cmd
+}
+
+// report lists the migrations that ran, or would have in a dry run
+func report(w io.Writer, done []Migration, err error, dryRun bool, verb, dryRunVerb string) error {
+    if dryRun {
+        verb = dryRunVerb
+    }
+    for _, m := range done {
+        fmt.Fprintf(w, "%s %d: %s\n", verb, m.Version, m.Description)
+    }
+    if err == nil && len(done) == 0 {
+        fmt.Fprintln(w, "Nothing to do")
+    }
+    return err
+}
+
+func writeStatus(out io.Writer, statuses []Status) error {
+    w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED AT\tDESCRIPTION")
+    for _, s := range statuses {
+        state, appliedAt := "pending", "-"
+        if s.Applied {
+            state, appliedAt = "applied", s.AppliedAt.Local().Format(time.RFC3339)
+        }
+        fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, state, appliedAt, s.Description)
+    }
+    return w.Flush()
+}
@@ -0,0 +1,348 @@
+package migrations
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "os"
+    "sort"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+    // Applied versions are recorded here, one document per version
+    collectionName = "migrations"
+    // A single document here stops two instances migrating at once
+    lockCollectionName = "migrations_lock"
+    lockID             = "lock"
+
+    // A crashed holder's lock is ignored once it is this old. It is renewed
+    // before each migration, so this only bounds a single migration.
+    lockTTL = 10 * time.Minute
+    // How long to wait for another instance to finish before giving up
+    lockWait = 2 * time.Minute
+)
+
+// ErrLocked means another instance held the migration lock for longer than
+// we were willing to wait
+var ErrLocked = errors.New("migrations are locked by another instance")
+
+// Migration is one versioned change to the database. Versions are applied
+// in increasing order and never reused. Mongo can't run DDL in a
+// transaction, so a crash between running a migration and recording it
+// runs it again: Up and Down must be safe to repeat.
+type Migration struct {
+    Version     int
+    Description string
+    Up          func(ctx context.Context, db *mongo.Database) error
+    // Down undoes Up. Migrations without one can't be rolled back.
+    Down func(ctx context.Context, db *mongo.Database) error
+}
+
+// Status is a migration along with whether and when it was applied
+type Status struct {
+    Migration
+    Applied   bool
+    AppliedAt time.Time
+}
+
+type record struct {
+    Version     int       `bson:"_id"`
+    Description string    `bson:"description"`
+    AppliedAt   time.Time `bson:"applied_at"`
+}
+
+var registered []Migration
+
+// register adds a migration. Each migration file calls it from init.
+func register(m Migration) {
+    for _, existing := range registered {
+        if existing.Version == m.Version {
+            panic(fmt.Sprintf("migrations: version %d registered twice", m.Version))
+        }
+    }
+    registered = append(registered, m)
+}
+
+// All returns every known migration in version order
+func All() []Migration {
+    all := append([]Migration(nil), registered...)
+    sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+    return all
+}
+
+// Migrator applies and rolls back migrations against one database
+type Migrator struct {
+    db    *mongo.Database
+    owner string
+}
+
+func NewMigrator(db *mongo.Database) *Migrator {
+    host, _ := os.Hostname()
+    return &Migrator{
+        db:    db,
+        owner: fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano()),
+    }
+}
+
+// Status lists every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+    applied, err := m.applied(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    var statuses []Status
+    for _, migration := range All() {
+        rec, ok := applied[migration.Version]
+        statuses = append(statuses, Status{
+            Migration: migration,
+            Applied:   ok,
+            AppliedAt: rec.AppliedAt,
+        })
+    }
+    return statuses, nil
+}
+
+// Up applies pending migrations up to and including target, or all of them
+// when target is 0, and returns the ones it applied. With dryRun it only
+// returns what it would apply.
+func (m *Migrator) Up(ctx context.Context, target int, dryRun bool) ([]Migration, error) {
+    plan := func() ([]Migration, error) {
+        applied, err := m.applied(ctx)
+        if err != nil {
+            return nil, err
+        }
+        return planUp(All(), applied, target), nil
+    }
+
+    if dryRun {
+        return plan()
+    }
+
+    unlock, err := m.lock(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer unlock()
+
+    // Planned under the lock, since whoever held it may have done the work
+    pending, err := plan()
+    if err != nil {
+        return nil, err
+    }
+
+    var done []Migration
+    for _, migration := range pending {
+        if err := m.renewLock(ctx); err != nil {
+            return done, err
+        }
+
+        slog.InfoContext(ctx, "applying migration", "version", migration.Version, "description", migration.Description)
+        if err := migration.Up(ctx, m.db); err != nil {
+            return done, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+        }
+
+        _, err := m.db.Collection(collectionName).InsertOne(ctx, record{
+            Version:     migration.Version,
+            Description: migration.Description,
+            AppliedAt:   time.Now(),
+        })
+        if err != nil {
+            return done, fmt.Errorf("recording migration %d: %w", migration.Version, err)
+        }
+        done = append(done, migration)
+    }
+    return done, nil
+}
+
+// Down rolls back applied migrations newer than target, newest first, and
+// returns the ones it rolled back. A negative target rolls back only the
+// latest one. With dryRun it only returns what it would roll back.
+func (m *Migrator) Down(ctx context.Context, target int, dryRun bool) ([]Migration, error) {
+    plan := func() ([]Migration, error) {
+        applied, err := m.applied(ctx)
+        if err != nil {
+            return nil, err
+        }
+        return planDown(All(), applied, target)
+    }
+
+    if dryRun {
+        return plan()
+    }
+
+    unlock, err := m.lock(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer unlock()
+
+    rollback, err := plan()
+    if err != nil {
+        return nil, err
+    }
+
+    var done []Migration
+    for _, migration := range rollback {
+        if err := m.renewLock(ctx); err != nil {
+            return done, err
+        }
+
+        slog.InfoContext(ctx, "rolling back migration", "version", migration.Version, "description", migration.Description)
+        if err := migration.Down(ctx, m.db); err != nil {
+            return done, fmt.Errorf("rolling back migration %d (%s): %w", migration.Version, migration.Description, err)
+        }
+
+        _, err := m.db.Collection(collectionName).DeleteOne(ctx, bson.M{"_id": migration.Version})
+        if err != nil {
+            return done, fmt.Errorf("unrecording migration %d: %w", migration.Version, err)
+        }
+        done = append(done, migration)
+    }
+    return done, nil
+}
+
+// planUp picks the migrations in all (sorted by version) that are not yet
+// applied, up to and including target, or every one when target is 0
+func planUp(all []Migration, applied map[int]record, target int) []Migration {
+    var pending []Migration
+    for _, migration := range all {
+        if _, ok := applied[migration.Version]; !ok && (target == 0 || migration.Version <= target) {
+            pending = append(pending, migration)
+        }
+    }
+    return pending
+}
+
+// planDown picks the applied migrations in all (sorted by version) newer
+// than target, newest first, or only the latest when target is negative.
+// It fails if any of them has no Down.
+func planDown(all []Migration, applied map[int]record, target int) ([]Migration, error) {
+    var rollback []Migration
+    for i := len(all) - 1; i >= 0; i-- {
+        if _, ok := applied[all[i].Version]; !ok {
+            continue
+        }
+        if target < 0 {
+            rollback = append(rollback, all[i])
+            break
+        }
+        if all[i].Version > target {
+            rollback = append(rollback, all[i])
+        }
+    }
+    for _, migration := range rollback {
+        if migration.Down == nil {
+            return nil, fmt.Errorf("migration %d (%s) can't be rolled back", migration.Version, migration.Description)
+        }
+    }
+    return rollback, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]record, error) {
+    cursor, err := m.db.Collection(collectionName).Find(ctx, bson.M{})
+    if err != nil {
+        return nil, err
+    }
+
+    var records []record
+    if err := cursor.All(ctx, &records); err != nil {
+        return nil, err
+    }
+
+    applied := make(map[int]record, len(records))
+    for _, rec := range records {
+        applied[rec.Version] = rec
+    }
+    return applied, nil
+}
+
+// lock takes the migration lock, waiting for another holder to finish or
+// for its lock to go stale. The returned func releases it.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+    locks := m.db.Collection(lockCollectionName)
+    deadline := time.Now().Add(lockWait)
+
+    for {
+        // Only matches a stale lock, or none at all thanks to the upsert. A
+        // live lock makes the upsert collide on _id instead.
+        now := time.Now()
+        _, err := locks.UpdateOne(ctx,
+            bson.M{"_id": lockID, "expires_at": bson.M{"$lt": now}},
+            bson.M{"$set": bson.M{
+                "owner":      m.owner,
+                "locked_at":  now,
+                "expires_at": now.Add(lockTTL),
+            }},
+            options.Update().SetUpsert(true),
+        )
+        if err == nil {
+            break
+        }
+        if !mongo.IsDuplicateKeyError(err) {
+            return nil, err
+        }
+        if now.After(deadline) {
+            return nil, ErrLocked
+        }
+
+        select {
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        case <-time.After(time.Second):
+        }
+    }
+
+    return func() {
+        // Release even if ctx was cancelled mid-migration
+        releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+        defer cancel()
+        if _, err := locks.DeleteOne(releaseCtx, bson.M{"_id": lockID, "owner": m.owner}); err != nil {
+            slog.WarnContext(ctx, "failed to release migration lock", "error", err)
+        }
+    }, nil
+}
+
+func (m *Migrator) renewLock(ctx context.Context) error {
+    result, err := m.db.Collection(lockCollectionName).UpdateOne(ctx,
+        bson.M{"_id": lockID, "owner": m.owner},
+        bson.M{"$set": bson.M{"expires_at": time.Now().Add(lockTTL)}},
+    )
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return errors.New("lost the migration lock")
+    }
+    return nil
+}
+
+// createIndexes is for migrations. Creating an index that already exists
+// with the same options does nothing, so it is safe to repeat.
+func createIndexes(ctx context.Context, coll *mongo.Collection, indexes ...mongo.IndexModel) error {
+    if _, err := coll.Indexes().CreateMany(ctx, indexes); err != nil {
+        return fmt.Errorf("creating %s indexes: %w", coll.Name(), err)
+    }
+    return nil
+}
+
+// dropIndexes is for migrations. Indexes that are already gone are skipped.
+func dropIndexes(ctx context.Context, coll *mongo.Collection, names ...string) error {
+    for _, name := range names {
+        _, err := coll.Indexes().DropOne(ctx, name)
+        var cmdErr mongo.CommandError
+        if errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound") {
+            continue
+        }
+        if err != nil {
+            return fmt.Errorf("dropping %s.%s index: %w", coll.Name(), name, err)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,120 @@
+package migrations
+
+import (
+    "context"
+    "reflect"
+    "strings"
+    "testing"
+
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+func noop(ctx context.Context, db *mongo.Database) error {
+    return nil
+}
+
+// testMigrations are versions 1, 2, 5 and 7; 5 has no Down
+func testMigrations() []Migration {
+    return []Migration{
+        {Version: 1, Description: "one", Up: noop, Down: noop},
+        {Version: 2, Description: "two", Up: noop, Down: noop},
+        {Version: 5, Description: "five", Up: noop},
+        {Version: 7, Description: "seven", Up: noop, Down: noop},
+    }
+}
+
+func appliedVersions(versions ...int) map[int]record {
+    applied := make(map[int]record, len(versions))
+    for _, v := range versions {
+        applied[v] = record{Version: v}
+    }
+    return applied
+}
+
+func versionsOf(migrations []Migration) []int {
+    var versions []int
+    for _, m := range migrations {
+        versions = append(versions, m.Version)
+    }
+    return versions
+}
+
+func TestPlanUp(t *testing.T) {
+    tests := []struct {
+        name    string
+        applied map[int]record
+        target  int
+        want    []int
+    }{
+        {"fresh database", appliedVersions(), 0, []int{1, 2, 5, 7}},
+        {"some applied", appliedVersions(1, 2), 0, []int{5, 7}},
+        {"all applied", appliedVersions(1, 2, 5, 7), 0, nil},
+        {"gap left by an out of order deploy", appliedVersions(1, 5), 0, []int{2, 7}},
+        {"up to a target", appliedVersions(1), 5, []int{2, 5}},
+        {"target between versions", appliedVersions(), 4, []int{1, 2}},
+        {"target already reached", appliedVersions(1, 2), 2, nil},
+        {"target below everything", appliedVersions(), -1, nil},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := versionsOf(planUp(testMigrations(), tt.applied, tt.target))
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("planUp() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestPlanDown(t *testing.T) {
+    tests := []struct {
+        name    string
+        applied map[int]record
+        target  int
+        want    []int
+        wantErr string
+    }{
+        {"latest only", appliedVersions(1, 2), -1, []int{2}, ""},
+        {"latest skips unapplied versions", appliedVersions(1, 2, 5, 7), -1, []int{7}, ""},
+        {"down to a target, newest first", appliedVersions(1, 2), 0, []int{2, 1}, ""},
+        {"target between versions", appliedVersions(1, 2), 1, []int{2}, ""},
+        {"target already reached", appliedVersions(1, 2), 2, nil, ""},
+        {"nothing applied", appliedVersions(), -1, nil, ""},
+        {"only applied versions roll back", appliedVersions(1, 7), 0, []int{7, 1}, ""},
+        {"irreversible migration in the way", appliedVersions(1, 2, 5, 7), 2, nil, "migration 5"},
+        {"irreversible latest", appliedVersions(1, 2, 5), -1, nil, "migration 5"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            plan, err := planDown(testMigrations(), tt.applied, tt.target)
+            if tt.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("planDown() error = %v, want it to mention %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("planDown() error = %v", err)
+            }
+            if got := versionsOf(plan); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("planDown() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRegisteredMigrations(t *testing.T) {
+    all := All()
+    if len(all) == 0 {
+        t.Fatal("no migrations registered")
+    }
+    for i, m := range all {
+        if m.Up == nil {
+            t.Errorf("migration %d has no Up", m.Version)
+        }
+        if i > 0 && m.Version <= all[i-1].Version {
+            t.Errorf("migration %d is out of order after %d", m.Version, all[i-1].Version)
+        }
+    }
+}
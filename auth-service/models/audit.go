@@ -0,0 +1,40 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit event types
+const (
+    AuditMFAEnabled             = "mfa.enabled"
+    AuditMFADisabled            = "mfa.disabled"
+    AuditMFALockedOut           = "mfa.locked_out"
+    AuditRecoveryCodesGenerated = "mfa.recovery_codes_generated"
+    AuditRecoveryCodeUsed       = "mfa.recovery_code_used"
+    AuditPasskeyRegistered      = "passkey.registered"
+    AuditPasskeyRemoved         = "passkey.removed"
+    AuditPasskeyCloneWarning    = "passkey.clone_warning"
+    AuditClientCreated          = "oauth_client.created"
+    AuditClientUpdated          = "oauth_client.updated"
+    AuditClientSecretRotated    = "oauth_client.secret_rotated"
+    AuditClientDisabled         = "oauth_client.disabled"
+    AuditClientEnabled          = "oauth_client.enabled"
+    AuditImpersonationStarted   = "admin.impersonation_started"
+    AuditUserCreated            = "user.created"
+    AuditUserSuspended          = "user.suspended"
+    AuditUserUnsuspended        = "user.unsuspended"
+    AuditUserDeleted            = "user.deleted"
+    AuditSessionRevoked         = "user.session_revoked"
+)
+
+type AuditEvent struct {
+    ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+    Type      string                 `json:"type" bson:"type"`
+    UserID    primitive.ObjectID     `json:"user_id" bson:"user_id"`
+    IPAddress string                 `json:"ip_address,omitempty" bson:"ip_address,omitempty"`
+    UserAgent string                 `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+    RequestID string                 `json:"request_id,omitempty" bson:"request_id,omitempty"`
+    Details   map[string]interface{} `json:"details,omitempty" bson:"details,omitempty"`
+    CreatedAt time.Time              `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Grant types a client can be allowed to use
+const (
+    GrantAuthorizationCode = "authorization_code"
+    GrantClientCredentials = "client_credentials"
+    GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+    GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// OAuthClient is an application allowed to sign users in through the OIDC
+// provider. Public clients (SPAs, mobile apps) have no secret and rely on PKCE.
+//
+// AllowedScopes caps what the client may request; token lifetimes are in
+// seconds, with zero meaning the server default. Disabled clients cannot
+// obtain new tokens, but tokens already issued stay valid until they expire.
+type OAuthClient struct {
+    ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    ClientID        string             `json:"client_id" bson:"client_id"`
+    SecretHash      string             `json:"-" bson:"secret_hash,omitempty"`
+    Name            string             `json:"name" bson:"name"`
+    RedirectURIs    []string           `json:"redirect_uris" bson:"redirect_uris"`
+    AllowedScopes   []string           `json:"allowed_scopes" bson:"allowed_scopes"`
+    GrantTypes      []string           `json:"grant_types" bson:"grant_types"`
+    AccessTokenTTL  int                `json:"access_token_ttl,omitempty" bson:"access_token_ttl,omitempty"`
+    IDTokenTTL      int                `json:"id_token_ttl,omitempty" bson:"id_token_ttl,omitempty"`
+    Public          bool               `json:"public" bson:"public"`
+    Disabled        bool               `json:"disabled" bson:"disabled"`
+    CreatedBy       primitive.ObjectID `json:"created_by,omitempty" bson:"created_by,omitempty"`
+    SecretRotatedAt time.Time          `json:"secret_rotated_at,omitempty" bson:"secret_rotated_at,omitempty"`
+    CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+    UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// AuthorizationRequest is a validated /oauth/authorize call waiting for the
+// user to sign in and approve it in the login UI
+type AuthorizationRequest struct {
+    ID                  string    `bson:"_id"`
+    ClientID            string    `bson:"client_id"`
+    RedirectURI         string    `bson:"redirect_uri"`
+    Scope               string    `bson:"scope"`
+    State               string    `bson:"state,omitempty"`
+    Nonce               string    `bson:"nonce,omitempty"`
+    CodeChallenge       string    `bson:"code_challenge"`
+    CodeChallengeMethod string    `bson:"code_challenge_method"`
+    ExpiresAt           time.Time `bson:"expires_at"`
+}
+
+// AuthorizationCode is issued once the user approves a request. Only its
+// hash is stored and it is deleted when redeemed.
+type AuthorizationCode struct {
+    CodeHash      string             `bson:"_id"`
+    ClientID      string             `bson:"client_id"`
+    UserID        primitive.ObjectID `bson:"user_id"`
+    RedirectURI   string             `bson:"redirect_uri"`
+    Scope         string             `bson:"scope"`
+    Nonce         string             `bson:"nonce,omitempty"`
+    CodeChallenge string             `bson:"code_challenge"`
+    AuthTime      time.Time          `bson:"auth_time"`
+    ExpiresAt     time.Time          `bson:"expires_at"`
+}
+
+// Device authorization states
+const (
+    DeviceStatusPending  = "pending"
+    DeviceStatusApproved = "approved"
+    DeviceStatusDenied   = "denied"
+)
+
+// DeviceAuthorization is an RFC 8628 device login in progress. The device
+// polls with the device code (stored hashed) while the user approves the
+// short user code in a browser.
+type DeviceAuthorization struct {
+    DeviceCodeHash string             `bson:"_id"`
+    UserCode       string             `bson:"user_code"`
+    ClientID       string             `bson:"client_id"`
+    Scope          string             `bson:"scope"`
+    Status         string             `bson:"status"`
+    UserID         primitive.ObjectID `bson:"user_id,omitempty"`
+    AuthTime       time.Time          `bson:"auth_time,omitempty"`
+    Interval       int                `bson:"interval"`
+    LastPolledAt   time.Time          `bson:"last_polled_at"`
+    ExpiresAt      time.Time          `bson:"expires_at"`
+}
+
+// RevokedToken denylists a token by its jti until the token would have
+// expired anyway, after which the TTL index removes it
+type RevokedToken struct {
+    TokenID   string    `bson:"_id"`
+    ClientID  string    `bson:"client_id,omitempty"`
+    Reason    string    `bson:"reason,omitempty"`
+    RevokedAt time.Time `bson:"revoked_at"`
+    ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// SigningKey is an RSA key used to sign ID tokens. Old keys stay published
+// in the JWKS after rotation so tokens they signed can still be verified.
+type SigningKey struct {
+    KeyID         string    `bson:"_id"`
+    Algorithm     string    `bson:"algorithm"`
+    PrivateKeyPEM string    `bson:"private_key_pem"`
+    Active        bool      `bson:"active"`
+    CreatedAt     time.Time `bson:"created_at"`
+}
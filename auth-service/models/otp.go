@@ -0,0 +1,25 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OTP challenge purposes. A user has at most one pending challenge per purpose.
+const (
+    OTPPurposeLogin = "login"
+)
+
+// OTPChallenge is a one-time code waiting to be verified. It lives in its own
+// collection so the TTL index that expires it can't touch the user.
+type OTPChallenge struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty"`
+    UserID         primitive.ObjectID `bson:"user_id"`
+    Email          string             `bson:"email"`
+    Purpose        string             `bson:"purpose"`
+    CodeHash       string             `bson:"code_hash"`
+    Attempts       int                `bson:"attempts"`
+    MagicLinkNonce string             `bson:"magic_link_nonce,omitempty"`
+    ExpiresAt      time.Time          `bson:"expires_at"`
+    CreatedAt      time.Time          `bson:"created_at"`
+}
@@ -6,18 +6,35 @@ import (
 )
 
 type User struct {
-    ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    Name          string             `json:"name" bson:"name"`
-    Email         string             `json:"email" bson:"email"`
-    RollNumber    string             `json:"roll_number" bson:"roll_number"`
-    Branch        string             `json:"branch" bson:"branch"`
-    AdmissionYear string             `json:"admission_year" bson:"admission_year"`
-    CurrentYear   string             `json:"current_year" bson:"current_year"`
-    YearNumber    int                `json:"year_number" bson:"year_number"`
-    Batch         string             `json:"batch" bson:"batch"`
-    OTP           string             `json:"-" bson:"otp,omitempty"`
-    OTPExpiresAt  time.Time          `json:"-" bson:"otp_expires_at,omitempty"`
-    RefreshToken  string             `json:"-" bson:"refresh_token,omitempty"`
-    IsVerified    bool               `json:"is_verified" bson:"is_verified"`
-    CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
-}
\ No newline at end of file
+    ID                  primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+    Name                string               `json:"name" bson:"name"`
+    Email               string               `json:"email" bson:"email"`
+    RollNumber          string               `json:"roll_number" bson:"roll_number"`
+    Branch              string               `json:"branch" bson:"branch"`
+    AdmissionYear       string               `json:"admission_year" bson:"admission_year"`
+    CurrentYear         string               `json:"current_year" bson:"current_year"`
+    YearNumber          int                  `json:"year_number" bson:"year_number"`
+    Batch               string               `json:"batch" bson:"batch"`
+    Locale              string               `json:"locale,omitempty" bson:"locale,omitempty"`
+    LoginCodeHash       string               `json:"-" bson:"login_code_hash,omitempty"`
+    LoginCodeExpiresAt  time.Time            `json:"-" bson:"login_code_expires_at,omitempty"`
+    RefreshToken        string               `json:"-" bson:"refresh_token,omitempty"`
+    MFAEnabled          bool                 `json:"mfa_enabled" bson:"mfa_enabled"`
+    TOTPSecret          string               `json:"-" bson:"totp_secret,omitempty"`
+    TOTPPendingSecret   string               `json:"-" bson:"totp_pending_secret,omitempty"`
+    TOTPLastStep        int64                `json:"-" bson:"totp_last_step,omitempty"`
+    MFAAttempts         int                  `json:"-" bson:"mfa_attempts,omitempty"`
+    MFALockedUntil      time.Time            `json:"-" bson:"mfa_locked_until,omitempty"`
+    RecoveryCodes       []string             `json:"-" bson:"recovery_codes,omitempty"`
+    WebAuthnCredentials []WebAuthnCredential `json:"-" bson:"webauthn_credentials,omitempty"`
+    Role                string               `json:"role,omitempty" bson:"role,omitempty"`
+    Suspended           bool                 `json:"suspended,omitempty" bson:"suspended,omitempty"`
+    SuspendedAt         time.Time            `json:"-" bson:"suspended_at,omitempty"`
+    IsVerified          bool                 `json:"is_verified" bson:"is_verified"`
+    CreatedAt           time.Time            `json:"created_at" bson:"created_at"`
+}
+
+// User roles. Users without a role are ordinary students.
+const (
+    RoleAdmin = "admin"
+)
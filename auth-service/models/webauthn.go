@@ -0,0 +1,34 @@
+package models
+
+import (
+    "time"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebAuthnCredential is a passkey registered by a user. It is stored on the
+// user document and converted to the webauthn library's type when needed.
+type WebAuthnCredential struct {
+    CredentialID    []byte    `json:"-" bson:"credential_id"`
+    Name            string    `json:"name" bson:"name"`
+    PublicKey       []byte    `json:"-" bson:"public_key"`
+    AttestationType string    `json:"-" bson:"attestation_type"`
+    AttestationFmt  string    `json:"-" bson:"attestation_format"`
+    Transports      []string  `json:"transports,omitempty" bson:"transports,omitempty"`
+    AAGUID          []byte    `json:"-" bson:"aaguid,omitempty"`
+    Flags           uint8     `json:"-" bson:"flags"`
+    SignCount       uint32    `json:"-" bson:"sign_count"`
+    CreatedAt       time.Time `json:"created_at" bson:"created_at"`
+    LastUsedAt      time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+}
+
+// WebAuthnSession holds the challenge state between the options and verify
+// steps of a registration or login ceremony
+type WebAuthnSession struct {
+    ID        string             `bson:"_id"`
+    Purpose   string             `bson:"purpose"`
+    UserID    primitive.ObjectID `bson:"user_id,omitempty"`
+    Data      string             `bson:"data"`
+    ExpiresAt time.Time          `bson:"expires_at"`
+    // Set on registrations begun after the user confirmed their second factor
+    SecondFactor bool `bson:"second_factor,omitempty"`
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+    "context"
+    "math"
+    "sync"
+    "time"
+)
+
+// MemoryLimiter is a token bucket per key held in this process. Each
+// bucket holds up to Limit tokens and refills at Limit per Window, so
+// short bursts are allowed but the long-run rate is capped.
+type MemoryLimiter struct {
+    rate      Rate
+    mu        sync.Mutex
+    buckets   map[string]*bucket
+    lastSweep time.Time
+    now       func() time.Time
+}
+
+type bucket struct {
+    tokens float64
+    last   time.Time
+}
+
+func NewMemoryLimiter(rate Rate) *MemoryLimiter {
+    return &MemoryLimiter{
+        rate:      rate,
+        buckets:   make(map[string]*bucket),
+        lastSweep: time.Now(),
+        now:       time.Now,
+    }
+}
+
+func (ml *MemoryLimiter) Rate() Rate {
+    return ml.rate
+}
+
+func (ml *MemoryLimiter) Allow(ctx context.Context, key string) (Result, error) {
+    ml.mu.Lock()
+    defer ml.mu.Unlock()
+
+    now := ml.now()
+    ml.sweep(now)
+
+    capacity := float64(ml.rate.Limit)
+    perSecond := capacity / ml.rate.Window.Seconds()
+
+    b, ok := ml.buckets[key]
+    if !ok {
+        b = &bucket{tokens: capacity, last: now}
+        ml.buckets[key] = b
+    }
+
+    b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+    b.last = now
+
+    result := Result{Limit: ml.rate.Limit}
+    if b.tokens >= 1 {
+        b.tokens--
+        result.Allowed = true
+    } else {
+        result.RetryAfter = secondsToDuration((1 - b.tokens) / perSecond)
+    }
+
+    result.Remaining = int(math.Floor(b.tokens))
+    result.Reset = secondsToDuration((capacity - b.tokens) / perSecond)
+    return result, nil
+}
+
+// sweep drops buckets that have refilled completely, at most once a window
+func (ml *MemoryLimiter) sweep(now time.Time) {
+    if now.Sub(ml.lastSweep) < ml.rate.Window {
+        return
+    }
+    ml.lastSweep = now
+
+    for key, b := range ml.buckets {
+        if now.Sub(b.last) >= ml.rate.Window {
+            delete(ml.buckets, key)
+        }
+    }
+}
+
+func secondsToDuration(s float64) time.Duration {
+    return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+// fakeClock is advanced by hand so refills do not depend on sleeping
+type fakeClock struct {
+    t time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+    return fc.t
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+    fc.t = fc.t.Add(d)
+}
+
+func newTestLimiter(rate Rate) (*MemoryLimiter, *fakeClock) {
+    clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+    ml := NewMemoryLimiter(rate)
+    ml.now = clock.Now
+    ml.lastSweep = clock.t
+    return ml, clock
+}
+
+func TestMemoryLimiterAllow(t *testing.T) {
+    // one token every two seconds, which float arithmetic represents exactly
+    rate := Rate{Limit: 4, Window: 8 * time.Second}
+
+    type step struct {
+        advance       time.Duration
+        key           string
+        wantAllowed   bool
+        wantRemaining int
+        wantRetry     time.Duration
+    }
+
+    tests := []struct {
+        name  string
+        steps []step
+    }{
+        {
+            name: "burst up to the limit",
+            steps: []step{
+                {0, "a", true, 3, 0},
+                {0, "a", true, 2, 0},
+                {0, "a", true, 1, 0},
+                {0, "a", true, 0, 0},
+                {0, "a", false, 0, 2 * time.Second},
+            },
+        },
+        {
+            name: "refills over the window",
+            steps: []step{
+                {0, "a", true, 3, 0},
+                {0, "a", true, 2, 0},
+                {0, "a", true, 1, 0},
+                {0, "a", true, 0, 0},
+                {2 * time.Second, "a", true, 0, 0},
+                {0, "a", false, 0, 2 * time.Second},
+                {time.Second, "a", false, 0, time.Second},
+                {time.Second, "a", true, 0, 0},
+            },
+        },
+        {
+            name: "never refills past the limit",
+            steps: []step{
+                {0, "a", true, 3, 0},
+                {time.Hour, "a", true, 3, 0},
+            },
+        },
+        {
+            name: "keys are independent",
+            steps: []step{
+                {0, "a", true, 3, 0},
+                {0, "a", true, 2, 0},
+                {0, "a", true, 1, 0},
+                {0, "a", true, 0, 0},
+                {0, "a", false, 0, 2 * time.Second},
+                {0, "b", true, 3, 0},
+            },
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ml, clock := newTestLimiter(rate)
+
+            for i, s := range tt.steps {
+                clock.Advance(s.advance)
+                res, err := ml.Allow(context.Background(), s.key)
+                if err != nil {
+                    t.Fatalf("step %d: Allow() error = %v", i, err)
+                }
+                if res.Allowed != s.wantAllowed || res.Remaining != s.wantRemaining || res.RetryAfter != s.wantRetry {
+                    t.Errorf("step %d: Allow(%q) = allowed %v, remaining %d, retry after %v; want %v, %d, %v",
+                        i, s.key, res.Allowed, res.Remaining, res.RetryAfter, s.wantAllowed, s.wantRemaining, s.wantRetry)
+                }
+                if res.Limit != rate.Limit {
+                    t.Errorf("step %d: Limit = %d, want %d", i, res.Limit, rate.Limit)
+                }
+            }
+        })
+    }
+}
+
+func TestMemoryLimiterReset(t *testing.T) {
+    ml, _ := newTestLimiter(Rate{Limit: 4, Window: 8 * time.Second})
+
+    res, _ := ml.Allow(context.Background(), "a")
+    if res.Reset != 2*time.Second {
+        t.Errorf("Reset after one event = %v, want 2s", res.Reset)
+    }
+
+    ml.Allow(context.Background(), "a")
+    res, _ = ml.Allow(context.Background(), "a")
+    if res.Reset != 6*time.Second {
+        t.Errorf("Reset after three events = %v, want 6s", res.Reset)
+    }
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+    ml, clock := newTestLimiter(Rate{Limit: 2, Window: time.Minute})
+
+    ml.Allow(context.Background(), "idle")
+    clock.Advance(30 * time.Second)
+    ml.Allow(context.Background(), "busy")
+
+    clock.Advance(40 * time.Second)
+    ml.Allow(context.Background(), "busy")
+
+    if _, ok := ml.buckets["idle"]; ok {
+        t.Error("idle bucket was not swept after a full window")
+    }
+    if _, ok := ml.buckets["busy"]; !ok {
+        t.Error("busy bucket was swept")
+    }
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// MongoLimiter is a sliding window counter shared by every instance. It
+// keeps one counter document per key and fixed window, and estimates the
+// rolling count by weighting the previous window by how much of it still
+// overlaps the last Window. Keys are hashed so emails are not stored.
+type MongoLimiter struct {
+    coll *mongo.Collection
+    name string
+    rate Rate
+}
+
+type windowCounter struct {
+    Count int `bson:"count"`
+}
+
+func NewMongoLimiter(coll *mongo.Collection, name string, rate Rate) *MongoLimiter {
+    return &MongoLimiter{coll: coll, name: name, rate: rate}
+}
+
+func (ml *MongoLimiter) Rate() Rate {
+    return ml.rate
+}
+
+func (ml *MongoLimiter) Allow(ctx context.Context, key string) (Result, error) {
+    now := time.Now()
+    windowStart := now.Truncate(ml.rate.Window)
+    hashed := utils.HashToken(ml.name + ":" + key)
+
+    var current windowCounter
+    err := ml.coll.FindOneAndUpdate(ctx,
+        bson.M{"_id": ml.counterID(hashed, windowStart)},
+        bson.M{
+            "$inc":         bson.M{"count": 1},
+            "$setOnInsert": bson.M{"expires_at": windowStart.Add(2 * ml.rate.Window)},
+        },
+        options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+    ).Decode(&current)
+    if err != nil {
+        return Result{}, err
+    }
+
+    var previous windowCounter
+    err = ml.coll.FindOne(ctx, bson.M{"_id": ml.counterID(hashed, windowStart.Add(-ml.rate.Window))}).Decode(&previous)
+    if err != nil && err != mongo.ErrNoDocuments {
+        return Result{}, err
+    }
+
+    elapsed := now.Sub(windowStart)
+    overlap := 1 - float64(elapsed)/float64(ml.rate.Window)
+    estimate := float64(previous.Count)*overlap + float64(current.Count)
+
+    result := Result{
+        Allowed:   estimate <= float64(ml.rate.Limit),
+        Limit:     ml.rate.Limit,
+        Remaining: int(math.Max(0, math.Floor(float64(ml.rate.Limit)-estimate))),
+        Reset:     ml.rate.Window - elapsed,
+    }
+    if !result.Allowed {
+        result.RetryAfter = result.Reset
+    }
+    return result, nil
+}
+
+func (ml *MongoLimiter) counterID(hashedKey string, windowStart time.Time) string {
+    return fmt.Sprintf("%s:%s:%d", ml.name, hashedKey, windowStart.Unix())
+}
@@ -0,0 +1,51 @@
+// Package ratelimit limits how often a key (an IP, an email, a user) may do
+// something. Limiters are created per route with New, on the backend the
+// rate_limit config selects: "memory" (default, per instance) or "mongo"
+// (shared by every instance).
+package ratelimit
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+// Rate allows Limit events per Window
+type Rate struct {
+    Limit  int
+    Window time.Duration
+}
+
+func (r Rate) String() string {
+    return fmt.Sprintf("%d;w=%d", r.Limit, int(r.Window.Seconds()))
+}
+
+// Result describes the state of a key after an Allow call
+type Result struct {
+    Allowed    bool
+    Limit      int
+    Remaining  int
+    Reset      time.Duration // until the quota is fully restored
+    RetryAfter time.Duration // until the next event would be allowed, when denied
+}
+
+// Limiter decides whether the next event for key is allowed and records it
+type Limiter interface {
+    Allow(ctx context.Context, key string) (Result, error)
+    Rate() Rate
+}
+
+// New returns a limiter named name (keys of different limiters never mix)
+// on the backend cfg selects. A rule for name in cfg replaces rate.
+func New(cfg config.RateLimitConfig, name string, rate Rate) Limiter {
+    if rule, ok := cfg.Rules[name]; ok {
+        rate = Rate{Limit: rule.Limit, Window: rule.Window.Std()}
+    }
+
+    if cfg.Backend == "mongo" {
+        return NewMongoLimiter(config.RateLimitCollection, name, rate)
+    }
+    return NewMemoryLimiter(rate)
+}
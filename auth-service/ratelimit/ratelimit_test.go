@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+    "testing"
+    "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+func TestNewRateRules(t *testing.T) {
+    fallback := Rate{Limit: 5, Window: time.Minute}
+
+    tests := []struct {
+        name string
+        cfg  config.RateLimitConfig
+        want Rate
+    }{
+        {"no rules", config.RateLimitConfig{Backend: "memory"}, fallback},
+        {"rule for another limiter", config.RateLimitConfig{
+            Backend: "memory",
+            Rules:   map[string]config.RateRule{"login": {Limit: 1, Window: config.Duration(time.Second)}},
+        }, fallback},
+        {"rule replaces the default", config.RateLimitConfig{
+            Backend: "memory",
+            Rules:   map[string]config.RateRule{"otp": {Limit: 10, Window: config.Duration(time.Hour)}},
+        }, Rate{Limit: 10, Window: time.Hour}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            limiter := New(tt.cfg, "otp", fallback)
+            if _, ok := limiter.(*MemoryLimiter); !ok {
+                t.Fatalf("New() = %T, want *MemoryLimiter", limiter)
+            }
+            if got := limiter.Rate(); got != tt.want {
+                t.Errorf("Rate() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
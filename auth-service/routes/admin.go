@@ -0,0 +1,28 @@
+package routes
+
+import (
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/controllers"
+    "github.com/Anurag-spec1/goauthenticate/middleware"
+    "github.com/gin-gonic/gin"
+)
+
+// RegisterAdminRoutes exposes the admin API. Every route needs a
+// first-party token belonging to an admin.
+func RegisterAdminRoutes(r *gin.Engine, cfg *config.Config, h *controllers.Handler) {
+    admin := r.Group("/admin")
+    admin.Use(middleware.AuthMiddleware(cfg.JWT), middleware.FirstPartyOnly(), middleware.AdminMiddleware(cfg.Admin))
+    {
+        // Client registry
+        admin.GET("/clients", controllers.ListClients)
+        admin.POST("/clients", controllers.CreateClient)
+        admin.GET("/clients/:client_id", controllers.GetClient)
+        admin.PATCH("/clients/:client_id", controllers.UpdateClient)
+        admin.POST("/clients/:client_id/rotate-secret", controllers.RotateClientSecret)
+        admin.POST("/clients/:client_id/disable", controllers.DisableClient)
+        admin.POST("/clients/:client_id/enable", controllers.EnableClient)
+
+        // Support
+        admin.POST("/users/:id/impersonate", h.ImpersonateUser)
+    }
+}
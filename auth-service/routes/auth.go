@@ -1,35 +1,94 @@
 package routes
 
 import (
+    "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
     "github.com/Anurag-spec1/goauthenticate/controllers"
     "github.com/Anurag-spec1/goauthenticate/middleware"
+    "github.com/Anurag-spec1/goauthenticate/ratelimit"
     "github.com/gin-gonic/gin"
 )
 
-func RegisterAuthRoutes(r *gin.Engine) {
+func RegisterAuthRoutes(r *gin.Engine, cfg *config.Config, h *controllers.Handler) {
+    // Rate limits. OTP routes are also limited per email so a single
+    // account cannot be flooded or brute forced from many IPs.
+    requestOTPByIP := limit(cfg.RateLimit, "request-otp-ip", 30, time.Hour, middleware.KeyByIP)
+    requestOTPByEmail := limit(cfg.RateLimit, "request-otp-email", 5, 15*time.Minute, middleware.KeyByEmail)
+    verifyOTPByIP := limit(cfg.RateLimit, "verify-otp-ip", 60, 15*time.Minute, middleware.KeyByIP)
+    verifyOTPByEmail := limit(cfg.RateLimit, "verify-otp-email", 10, 15*time.Minute, middleware.KeyByEmail)
+    loginByIP := limit(cfg.RateLimit, "login-ip", 60, 15*time.Minute, middleware.KeyByIP)
+    refreshByIP := limit(cfg.RateLimit, "refresh-ip", 120, time.Hour, middleware.KeyByIP)
+    apiByUser := limit(cfg.RateLimit, "api-user", 300, time.Minute, middleware.KeyByUserID)
+
     // Public routes
-    r.POST("/auth/request-otp", controllers.RequestOTP)
-    r.POST("/auth/verify-otp", controllers.VerifyOTP)
-    r.POST("/auth/refresh", controllers.Refresh)
+    r.GET("/auth/challenge", loginByIP, h.IssueChallenge)
+    r.POST("/auth/request-otp", requestOTPByIP, requestOTPByEmail, h.RequestOTP)
+    r.POST("/auth/verify-otp", verifyOTPByIP, verifyOTPByEmail, h.VerifyOTP)
+    r.POST("/auth/refresh", refreshByIP, h.Refresh)
+    r.GET("/auth/magic-link", loginByIP, h.MagicLinkLogin)
+    r.POST("/auth/magic-link", loginByIP, h.ConfirmMagicLink)
+    r.POST("/auth/magic-link/exchange", loginByIP, h.ExchangeLoginCode)
+    r.POST("/auth/mfa/verify", loginByIP, h.VerifyMFA)
+    r.POST("/auth/webauthn/login/options", loginByIP, h.BeginPasskeyLogin)
+    r.POST("/auth/webauthn/login/verify", loginByIP, h.FinishPasskeyLogin)
 
     // Protected routes (require authentication)
     protected := r.Group("/api")
-    protected.Use(middleware.AuthMiddleware())
+    protected.Use(middleware.AuthMiddleware(cfg.JWT), apiByUser)
     {
-        protected.GET("/profile", controllers.GetProfile)
-        protected.GET("/test", func(c *gin.Context) {
-            c.JSON(200, gin.H{
-                "message": "This is a protected route",
-                "success": true,
-            })
-        })
+        protected.GET("/profile", middleware.RequireScope("profile"), controllers.GetProfile)
+
+        // Account management is only for our own login flow's tokens
+        account := protected.Group("/")
+        account.Use(middleware.FirstPartyOnly(), middleware.BlockImpersonation())
+
+        account.PUT("/profile/locale", controllers.UpdateLocale)
+
+        // Second factor management
+        account.GET("/mfa", controllers.GetMFAStatus)
+        account.POST("/mfa/totp/enroll", h.EnrollTOTP)
+        account.POST("/mfa/totp/confirm", controllers.ConfirmTOTP)
+        account.POST("/mfa/totp/disable", h.DisableTOTP)
+        account.POST("/mfa/recovery-codes/regenerate", h.RegenerateRecoveryCodes)
+
+        // Passkeys
+        account.POST("/webauthn/register/options", h.BeginPasskeyRegistration)
+        account.POST("/webauthn/register/verify", h.FinishPasskeyRegistration)
+        account.GET("/webauthn/credentials", controllers.ListPasskeys)
+        account.DELETE("/webauthn/credentials/:id", h.DeletePasskey)
     }
 
-    // Health check
+    // Routes for backend services using client_credentials tokens
+    service := r.Group("/api/service")
+    service.Use(middleware.ClientAuthMiddleware(cfg.JWT))
+    {
+        service.GET("/users", middleware.RequireScope("users:read"), controllers.LookupUser)
+        service.GET("/users/:id", middleware.RequireScope("users:read"), controllers.LookupUser)
+    }
+
+    // Accepts both user and service tokens
+    r.GET("/api/test", middleware.AnyAuthMiddleware(cfg.JWT), func(c *gin.Context) {
+        c.JSON(200, gin.H{
+            "message": "This is a protected route",
+            "success": true,
+            "subject_type": c.GetString("subject_type"),
+        })
+    })
+
+    // Probes. /health is kept for existing monitors; /readyz is the one
+    // that checks dependencies.
+    r.GET("/livez", controllers.Livez)
+    r.GET("/readyz", h.Readyz)
     r.GET("/health", func(c *gin.Context) {
         c.JSON(200, gin.H{
             "status": "OK",
             "message": "Authentication API is running",
         })
     })
-}
\ No newline at end of file
+}
+
+// limit builds a rate limiting middleware on the configured backend
+func limit(cfg config.RateLimitConfig, name string, n int, window time.Duration, key middleware.KeyFunc) gin.HandlerFunc {
+    return middleware.RateLimit(ratelimit.New(cfg, name, ratelimit.Rate{Limit: n, Window: window}), key)
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+    "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/controllers"
+    "github.com/Anurag-spec1/goauthenticate/middleware"
+    "github.com/gin-gonic/gin"
+)
+
+// RegisterOAuthRoutes exposes the OpenID Connect provider
+func RegisterOAuthRoutes(r *gin.Engine, cfg *config.Config, h *controllers.Handler) {
+    // Discovery
+    r.GET("/.well-known/openid-configuration", h.OpenIDConfiguration)
+    r.GET("/oauth/jwks", controllers.JWKS)
+
+    // Client-facing endpoints are limited per IP; device polling has its
+    // own slow_down handling on top
+    oauthByIP := limit(cfg.RateLimit, "oauth-ip", 120, time.Minute, middleware.KeyByIP)
+
+    // Resource servers may introspect on every request they serve
+    introspectByIP := limit(cfg.RateLimit, "introspect-ip", 1200, time.Minute, middleware.KeyByIP)
+
+    // Client registration and authorization code flow
+    r.POST("/oauth/register", oauthByIP, h.RegisterClient)
+    r.GET("/oauth/authorize", oauthByIP, h.Authorize)
+    r.GET("/oauth/authorize/requests/:id", oauthByIP, controllers.GetAuthorizationRequest)
+    r.POST("/oauth/token", oauthByIP, h.Token)
+    r.POST("/oauth/device_authorization", oauthByIP, h.DeviceAuthorization)
+
+    // Token introspection and revocation for clients
+    r.POST("/oauth/introspect", introspectByIP, h.Introspect)
+    r.POST("/oauth/revoke", oauthByIP, h.Revoke)
+
+    // Endpoints that need the signed-in user's access token
+    protected := r.Group("/")
+    protected.Use(middleware.AuthMiddleware(cfg.JWT))
+    {
+        protected.POST("/api/oauth/authorize", middleware.FirstPartyOnly(), middleware.BlockImpersonation(), controllers.ApproveAuthorization)
+        protected.GET("/api/device", middleware.FirstPartyOnly(), controllers.GetDeviceAuthorization)
+        protected.POST("/api/device", middleware.FirstPartyOnly(), middleware.BlockImpersonation(), controllers.ApproveDeviceAuthorization)
+        protected.GET("/oauth/userinfo", middleware.RequireScope("openid"), controllers.UserInfo)
+        protected.POST("/oauth/userinfo", middleware.RequireScope("openid"), controllers.UserInfo)
+    }
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+    "context"
+    "log/slog"
+    "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/logging"
+    "github.com/Anurag-spec1/goauthenticate/models"
+)
+
+type AuditService struct{}
+
+func NewAuditService() *AuditService {
+    return &AuditService{}
+}
+
+// Record stores a security-relevant event, tagged with the request ID from
+// ctx. Failures are logged rather than returned so a flaky audit write
+// never blocks the user's request.
+func (as *AuditService) Record(ctx context.Context, event models.AuditEvent) {
+    if event.CreatedAt.IsZero() {
+        event.CreatedAt = time.Now()
+    }
+    if event.RequestID == "" {
+        event.RequestID = logging.RequestID(ctx)
+    }
+
+    // Still record the event if the client has already gone away
+    writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+    defer cancel()
+
+    if _, err := config.AuditCollection.InsertOne(writeCtx, event); err != nil {
+        slog.ErrorContext(ctx, "failed to record audit event", "type", event.Type, "user_id", event.UserID.Hex(), "error", err)
+    }
+}
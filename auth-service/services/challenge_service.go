@@ -0,0 +1,224 @@
+package services
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/bits"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+const powChallengeLifetime = 5 * time.Minute
+
+var (
+    ErrChallengeInvalid  = errors.New("challenge is invalid or expired")
+    ErrChallengeFailed   = errors.New("challenge was not solved")
+    ErrChallengeRedeemed = errors.New("challenge was already used")
+)
+
+// CaptchaVerifier checks a CAPTCHA response token with its provider.
+// Implement it and pass it to NewChallengeService to plug in a provider
+// other than the built-in ones.
+type CaptchaVerifier interface {
+    Provider() string
+    SiteKey() string
+    Verify(ctx context.Context, response, remoteIP string) (bool, error)
+}
+
+// PoWChallenge is a hashcash-style puzzle: find a nonce such that
+// SHA-256(token + ":" + email + ":" + nonce) starts with Bits zero bits.
+// Including the email means a solution only works for the address it was
+// solved for.
+type PoWChallenge struct {
+    Token     string `json:"token"`
+    Bits      int    `json:"difficulty"`
+    ExpiresIn int    `json:"expires_in"`
+}
+
+// ChallengeService issues and checks the challenges RequestOTP demands
+// under abuse. Proof-of-work challenges are HMAC-signed, so any instance
+// can verify them; solved ones are recorded in redeemed_challenges until
+// they expire so each solution buys a single request.
+type ChallengeService struct {
+    secret  []byte
+    powBits int
+    captcha CaptchaVerifier
+}
+
+// NewChallengeService signs puzzles with cfg.Secret, or a key derived from
+// the JWT access secret in jwtCfg when it is empty. A non-nil captcha
+// replaces proof-of-work.
+func NewChallengeService(cfg config.ChallengeConfig, jwtCfg config.JWTConfig, captcha CaptchaVerifier) *ChallengeService {
+    secret := []byte(cfg.Secret)
+    if len(secret) == 0 {
+        secret = utils.DeriveKey(jwtCfg, "pow-challenge")
+    }
+
+    return &ChallengeService{
+        secret:  secret,
+        powBits: cfg.PoWBits,
+        captcha: captcha,
+    }
+}
+
+// Captcha returns the configured CAPTCHA verifier, or nil when challenges
+// are proof-of-work
+func (cs *ChallengeService) Captcha() CaptchaVerifier {
+    return cs.captcha
+}
+
+// NewProofOfWork issues a signed puzzle
+func (cs *ChallengeService) NewProofOfWork() (PoWChallenge, error) {
+    random, err := utils.GenerateSecureToken(16)
+    if err != nil {
+        return PoWChallenge{}, err
+    }
+
+    payload := fmt.Sprintf("%s.%d.%d", random, time.Now().Add(powChallengeLifetime).Unix(), cs.powBits)
+    return PoWChallenge{
+        Token:     payload + "." + cs.sign(payload),
+        Bits:      cs.powBits,
+        ExpiresIn: int(powChallengeLifetime.Seconds()),
+    }, nil
+}
+
+// VerifyProofOfWork checks the signature, expiry and solution, then spends
+// the challenge. A challenge already spent gives ErrChallengeRedeemed.
+func (cs *ChallengeService) VerifyProofOfWork(ctx context.Context, token, email, nonce string) error {
+    i := strings.LastIndex(token, ".")
+    if i < 0 || nonce == "" {
+        return ErrChallengeInvalid
+    }
+    payload, mac := token[:i], token[i+1:]
+    if !hmac.Equal([]byte(mac), []byte(cs.sign(payload))) {
+        return ErrChallengeInvalid
+    }
+
+    parts := strings.Split(payload, ".")
+    if len(parts) != 3 {
+        return ErrChallengeInvalid
+    }
+    expires, err1 := strconv.ParseInt(parts[1], 10, 64)
+    required, err2 := strconv.Atoi(parts[2])
+    if err1 != nil || err2 != nil || time.Now().Unix() > expires {
+        return ErrChallengeInvalid
+    }
+
+    sum := sha256.Sum256([]byte(token + ":" + strings.ToLower(email) + ":" + nonce))
+    if leadingZeroBits(sum[:]) < required {
+        return ErrChallengeFailed
+    }
+
+    // The TTL index removes the record once the token has expired anyway
+    _, err := config.RedeemedChallengeCollection.InsertOne(ctx, bson.M{
+        "_id":        token,
+        "expires_at": time.Unix(expires, 0),
+    })
+    if mongo.IsDuplicateKeyError(err) {
+        return ErrChallengeRedeemed
+    }
+    return err
+}
+
+func (cs *ChallengeService) sign(payload string) string {
+    mac := hmac.New(sha256.New, cs.secret)
+    mac.Write([]byte(payload))
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func leadingZeroBits(b []byte) int {
+    n := 0
+    for _, x := range b {
+        if x != 0 {
+            return n + bits.LeadingZeros8(x)
+        }
+        n += 8
+    }
+    return n
+}
+
+// siteVerifyCaptcha covers Turnstile, hCaptcha and reCAPTCHA, which share
+// the same siteverify protocol
+type siteVerifyCaptcha struct {
+    provider string
+    endpoint string
+    secret   string
+    siteKey  string
+    client   *http.Client
+}
+
+// NewCaptchaVerifier returns the verifier for the provider in cfg, or nil
+// when no provider is configured and challenges are proof-of-work
+func NewCaptchaVerifier(cfg config.ChallengeConfig) CaptchaVerifier {
+    endpoints := map[string]string{
+        "turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+        "hcaptcha":  "https://api.hcaptcha.com/siteverify",
+        "recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+    }
+
+    endpoint, ok := endpoints[cfg.CaptchaProvider]
+    if !ok || cfg.CaptchaSecret == "" {
+        return nil
+    }
+
+    return &siteVerifyCaptcha{
+        provider: cfg.CaptchaProvider,
+        endpoint: endpoint,
+        secret:   cfg.CaptchaSecret,
+        siteKey:  cfg.CaptchaSiteKey,
+        client:   &http.Client{Timeout: 10 * time.Second},
+    }
+}
+
+func (sv *siteVerifyCaptcha) Provider() string {
+    return sv.provider
+}
+
+func (sv *siteVerifyCaptcha) SiteKey() string {
+    return sv.siteKey
+}
+
+func (sv *siteVerifyCaptcha) Verify(ctx context.Context, response, remoteIP string) (bool, error) {
+    if response == "" {
+        return false, nil
+    }
+
+    form := url.Values{
+        "secret":   {sv.secret},
+        "response": {response},
+        "remoteip": {remoteIP},
+    }
+    req, err := http.NewRequestWithContext(ctx, "POST", sv.endpoint, strings.NewReader(form.Encode()))
+    if err != nil {
+        return false, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+    resp, err := sv.client.Do(req)
+    if err != nil {
+        return false, err
+    }
+    defer resp.Body.Close()
+
+    var result struct {
+        Success bool `json:"success"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+        return false, err
+    }
+    return result.Success, nil
+}
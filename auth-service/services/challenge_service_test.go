@@ -0,0 +1,136 @@
+package services
+
+import (
+    "context"
+    "crypto/sha256"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+// solves reports whether nonce solves challenge for email
+func solves(challenge PoWChallenge, email, nonce string) bool {
+    sum := sha256.Sum256([]byte(challenge.Token + ":" + strings.ToLower(email) + ":" + nonce))
+    return leadingZeroBits(sum[:]) >= challenge.Bits
+}
+
+// findNonce returns the first nonce for which ok holds, the way a client
+// searches for a solution
+func findNonce(t *testing.T, ok func(nonce string) bool) string {
+    t.Helper()
+
+    for i := 0; i < 1<<24; i++ {
+        if nonce := strconv.Itoa(i); ok(nonce) {
+            return nonce
+        }
+    }
+    t.Fatal("no nonce found")
+    return ""
+}
+
+func solve(t *testing.T, challenge PoWChallenge, email string) string {
+    t.Helper()
+    return findNonce(t, func(nonce string) bool { return solves(challenge, email, nonce) })
+}
+
+func TestVerifyProofOfWork(t *testing.T) {
+    testDB(t)
+
+    jwtCfg := config.JWTConfig{AccessSecret: strings.Repeat("a", 32)}
+    cs := NewChallengeService(config.ChallengeConfig{PoWBits: 8}, jwtCfg, nil)
+    ctx := context.Background()
+    email := "student@kiet.edu"
+
+    newChallenge := func(t *testing.T) PoWChallenge {
+        t.Helper()
+        challenge, err := cs.NewProofOfWork()
+        if err != nil {
+            t.Fatal(err)
+        }
+        return challenge
+    }
+
+    t.Run("a solution is accepted once", func(t *testing.T) {
+        challenge := newChallenge(t)
+        nonce := solve(t, challenge, email)
+
+        if err := cs.VerifyProofOfWork(ctx, challenge.Token, email, nonce); err != nil {
+            t.Fatalf("first verification: %v", err)
+        }
+        if err := cs.VerifyProofOfWork(ctx, challenge.Token, email, nonce); !errors.Is(err, ErrChallengeRedeemed) {
+            t.Errorf("replayed solution error = %v, want ErrChallengeRedeemed", err)
+        }
+    })
+
+    t.Run("the email is part of the puzzle", func(t *testing.T) {
+        challenge := newChallenge(t)
+        nonce := solve(t, challenge, email)
+
+        // Case does not matter, the address does
+        if err := cs.VerifyProofOfWork(ctx, challenge.Token, "Student@KIET.edu", nonce); err != nil {
+            t.Errorf("verification with a differently cased email: %v", err)
+        }
+
+        // A nonce that happens to solve it for both addresses proves nothing
+        challenge = newChallenge(t)
+        other := "someone.else@kiet.edu"
+        nonce = findNonce(t, func(nonce string) bool {
+            return solves(challenge, email, nonce) && !solves(challenge, other, nonce)
+        })
+        if err := cs.VerifyProofOfWork(ctx, challenge.Token, other, nonce); !errors.Is(err, ErrChallengeFailed) {
+            t.Errorf("verification for another email error = %v, want ErrChallengeFailed", err)
+        }
+    })
+
+    t.Run("a failed attempt does not spend the challenge", func(t *testing.T) {
+        challenge := newChallenge(t)
+        nonce := solve(t, challenge, email)
+
+        wrong := findNonce(t, func(nonce string) bool { return !solves(challenge, email, nonce) })
+        if err := cs.VerifyProofOfWork(ctx, challenge.Token, email, wrong); !errors.Is(err, ErrChallengeFailed) {
+            t.Fatalf("wrong nonce error = %v, want ErrChallengeFailed", err)
+        }
+        if err := cs.VerifyProofOfWork(ctx, challenge.Token, email, nonce); err != nil {
+            t.Errorf("verification after a wrong nonce: %v", err)
+        }
+    })
+
+    t.Run("tampered and foreign tokens are invalid", func(t *testing.T) {
+        challenge := newChallenge(t)
+
+        // Lowering the difficulty breaks the signature
+        i := strings.LastIndex(challenge.Token, ".")
+        payload, mac := challenge.Token[:i], challenge.Token[i+1:]
+        easier := strings.TrimSuffix(payload, "."+strconv.Itoa(challenge.Bits)) + ".0." + mac
+        if err := cs.VerifyProofOfWork(ctx, easier, email, "1"); !errors.Is(err, ErrChallengeInvalid) {
+            t.Errorf("tampered token error = %v, want ErrChallengeInvalid", err)
+        }
+
+        other := NewChallengeService(config.ChallengeConfig{PoWBits: 8, Secret: strings.Repeat("s", 32)}, jwtCfg, nil)
+        foreign, err := other.NewProofOfWork()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := cs.VerifyProofOfWork(ctx, foreign.Token, email, solve(t, foreign, email)); !errors.Is(err, ErrChallengeInvalid) {
+            t.Errorf("token signed with another secret error = %v, want ErrChallengeInvalid", err)
+        }
+
+        if err := cs.VerifyProofOfWork(ctx, "no-dot", email, "1"); !errors.Is(err, ErrChallengeInvalid) {
+            t.Errorf("malformed token error = %v, want ErrChallengeInvalid", err)
+        }
+    })
+
+    t.Run("an expired challenge is invalid", func(t *testing.T) {
+        payload := fmt.Sprintf("%s.%d.%d", "expired", time.Now().Add(-time.Second).Unix(), 0)
+        token := payload + "." + cs.sign(payload)
+
+        if err := cs.VerifyProofOfWork(ctx, token, email, "1"); !errors.Is(err, ErrChallengeInvalid) {
+            t.Errorf("expired challenge error = %v, want ErrChallengeInvalid", err)
+        }
+    })
+}
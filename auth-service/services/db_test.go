@@ -0,0 +1,39 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+// testDB points the collections at a fresh database on the MongoDB at
+// MONGO_TEST_URI and drops it afterwards. Tests that need the database are
+// skipped when the variable is unset.
+func testDB(t *testing.T) {
+    t.Helper()
+
+    uri := os.Getenv("MONGO_TEST_URI")
+    if uri == "" {
+        t.Skip("MONGO_TEST_URI is not set")
+    }
+
+    ctx := context.Background()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatal(err)
+    }
+    db := client.Database(fmt.Sprintf("goauthenticate_test_%d", time.Now().UnixNano()))
+    t.Cleanup(func() {
+        db.Drop(ctx)
+        client.Disconnect(ctx)
+    })
+
+    config.UseDatabase(db)
+}
@@ -2,187 +2,199 @@ package services
 
 import (
     "bytes"
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
-    "log"
+    "log/slog"
     "net/http"
-    "os"
     "strings"
     "time"
+
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/metrics"
+    "github.com/Anurag-spec1/goauthenticate/tracing"
 )
 
-type EmailService struct{}
+const resendEndpoint = "https://api.resend.com/emails"
 
-func NewEmailService() *EmailService {
-    return &EmailService{}
+type EmailService struct {
+    cfg       config.EmailConfig
+    templates *EmailTemplates
+    endpoint  string
 }
 
-func (es *EmailService) SendOTPEmail(to, otp string) error {
-    provider := os.Getenv("EMAIL_PROVIDER")
-    
-    // ADD THIS DEBUG LOGGING
-    log.Printf("🔍 DEBUG: EMAIL_PROVIDER='%s'", provider)
-    log.Printf("🔍 DEBUG: RESEND_API_KEY exists: %v", os.Getenv("RESEND_API_KEY") != "")
-    log.Printf("🔍 DEBUG: EMAIL_FROM='%s'", os.Getenv("EMAIL_FROM"))
-    
-    if provider == "resend" {
-        log.Println("🔍 DEBUG: Using Resend provider")
-        return es.sendViaResend(to, otp)
+// NewEmailService sends through the provider and as the sender in cfg
+func NewEmailService(cfg config.EmailConfig) *EmailService {
+    return &EmailService{cfg: cfg, templates: DefaultEmailTemplates(cfg), endpoint: resendEndpoint}
+}
+
+// SendOTPEmail sends the login OTP rendered in the given locale, saying it
+// expires after expiresIn. When magicLink is set the email also offers a
+// one-click login button.
+func (es *EmailService) SendOTPEmail(ctx context.Context, to, otp, locale, magicLink string, expiresIn time.Duration) error {
+    return es.send(ctx, to, TemplateOTP, locale, TemplateData{
+        OTP:              otp,
+        ExpiresInMinutes: int(expiresIn.Minutes()),
+        MagicLink:        magicLink,
+    })
+}
+
+// SendWelcomeEmail is sent once, when a user verifies their account for the first time
+func (es *EmailService) SendWelcomeEmail(ctx context.Context, to, name, locale string) error {
+    return es.send(ctx, to, TemplateWelcome, locale, TemplateData{Name: name})
+}
+
+// SendNewDeviceAlert warns the user about a sign-in from an unrecognised device
+func (es *EmailService) SendNewDeviceAlert(ctx context.Context, to, name, locale string, device DeviceInfo) error {
+    return es.send(ctx, to, TemplateNewDevice, locale, TemplateData{Name: name, Device: device})
+}
+
+// SendAccountSuspendedEmail tells the user their account has been suspended
+func (es *EmailService) SendAccountSuspendedEmail(ctx context.Context, to, name, locale, reason string) error {
+    return es.send(ctx, to, TemplateAccountSuspended, locale, TemplateData{Name: name, Reason: reason})
+}
+
+// SendRecoveryCodeUsedEmail notifies the user that one of their MFA recovery codes was spent
+func (es *EmailService) SendRecoveryCodeUsedEmail(ctx context.Context, to, name, locale string, remaining int, device DeviceInfo) error {
+    return es.send(ctx, to, TemplateRecoveryCodeUsed, locale, TemplateData{
+        Name:                   name,
+        Device:                 device,
+        RecoveryCodesRemaining: remaining,
+    })
+}
+
+// CheckConfig reports which provider emails will go through, and an error
+// if that provider is selected but can't be used
+func (es *EmailService) CheckConfig() (string, error) {
+    switch provider := es.cfg.Provider; provider {
+    case "resend":
+        if es.cfg.ResendAPIKey == "" {
+            return provider, errors.New("no Resend API key configured")
+        }
+        return provider, nil
+    case "", "simulation":
+        return "simulation", nil
+    default:
+        return provider, errors.New("unknown email provider, emails are not sent")
     }
-    
-    log.Printf("🔍 DEBUG: Falling back to simulation (provider='%s')", provider)
-    // Fallback to simulation
-    return es.simulateEmail(to, otp)
 }
 
-func (es *EmailService) sendViaResend(to, otp string) error {
-    apiKey := os.Getenv("RESEND_API_KEY")
-    from := os.Getenv("EMAIL_FROM")
+// send renders and delivers one email inside an "email.send" span
+func (es *EmailService) send(ctx context.Context, to, name, locale string, data TemplateData) (err error) {
+    ctx, span := tracing.Start(ctx, "email.send", attribute.String("email.template", name))
+    defer func() {
+        if err != nil {
+            span.RecordError(err)
+            span.SetStatus(codes.Error, err.Error())
+        }
+        span.End()
+    }()
+
+    data.Recipient = to
+    data.Brand = es.templates.BrandingFor(to)
+    data.Time = time.Now().Format("2006-01-02 15:04:05")
+
+    msg, err := es.templates.Render(name, locale, data)
+    if err != nil {
+        slog.ErrorContext(ctx, "failed to render email", "template", name, "error", err)
+        return err
+    }
+
+    provider := es.cfg.Provider
+    span.SetAttributes(attribute.String("email.provider", provider))
+    
+    slog.DebugContext(ctx, "sending email",
+        "template", name,
+        "provider", provider,
+        "resend_api_key_set", es.cfg.ResendAPIKey != "",
+        "email_from", es.cfg.From,
+    )
+    
+    // Only simulation prints emails. A real provider that fails reports it
+    // rather than leaking codes and login links into the logs.
+    switch provider {
+    case "resend":
+        return es.sendViaResend(ctx, to, data.Brand, msg)
+    case "", "simulation":
+        return es.simulateEmail(ctx, to, msg)
+    default:
+        return fmt.Errorf("unknown email provider %q", provider)
+    }
+}
+
+func (es *EmailService) sendViaResend(ctx context.Context, to string, brand Branding, msg *RenderedEmail) error {
+    apiKey := es.cfg.ResendAPIKey
+    from := es.cfg.From
     
     if apiKey == "" {
-        log.Println("⚠️ RESEND_API_KEY not set, falling back to simulation")
-        return es.simulateEmail(to, otp)
+        return errors.New("no Resend API key configured")
     }
     
     if from == "" {
         from = "onboarding@resend.dev"
     }
     
-    // HTML email template
-    htmlContent := fmt.Sprintf(`
-    <!DOCTYPE html>
-    <html>
-    <head>
-        <meta charset="UTF-8">
-        <meta name="viewport" content="width=device-width, initial-scale=1.0">
-        <title>KIET Authentication OTP</title>
-        <style>
-            body { font-family: 'Arial', sans-serif; background-color: #f7f9fc; margin: 0; padding: 0; }
-            .container { max-width: 600px; margin: 0 auto; background: white; border-radius: 12px; overflow: hidden; box-shadow: 0 4px 20px rgba(0,0,0,0.1); }
-            .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); padding: 30px; text-align: center; color: white; }
-            .content { padding: 40px; }
-            .otp-container { background: #f8f9fa; border: 2px dashed #667eea; border-radius: 10px; padding: 25px; text-align: center; margin: 30px 0; }
-            .otp-code { font-size: 42px; font-weight: bold; color: #667eea; letter-spacing: 10px; font-family: 'Courier New', monospace; margin: 15px 0; }
-            .footer { margin-top: 30px; padding-top: 20px; border-top: 1px solid #eee; color: #666; font-size: 12px; text-align: center; }
-            .security-note { background: #e3f2fd; padding: 15px; border-radius: 8px; margin: 20px 0; border-left: 4px solid #2196f3; }
-        </style>
-    </head>
-    <body>
-        <div class="container">
-            <div class="header">
-                <h1 style="margin: 0; font-size: 28px;">🔐 KIET Authentication</h1>
-                <p style="margin: 10px 0 0; opacity: 0.9;">Secure Access Portal</p>
-            </div>
-            <div class="content">
-                <h2 style="color: #333; margin-bottom: 20px;">Hello KIET Student!</h2>
-                <p style="color: #555; line-height: 1.6;">Your One-Time Password (OTP) for authentication is:</p>
-                
-                <div class="otp-container">
-                    <div class="otp-code">%s</div>
-                    <p style="color: #666; margin: 10px 0; font-size: 14px;">⏱️ Valid for 10 minutes</p>
-                </div>
-                
-                <div class="security-note">
-                    <strong style="color: #1976d2;">🔒 Security Notice:</strong>
-                    <ul style="margin: 10px 0; padding-left: 20px; color: #555;">
-                        <li>Do NOT share this OTP with anyone</li>
-                        <li>KIET staff will never ask for your OTP</li>
-                        <li>If you didn't request this, please ignore this email</li>
-                    </ul>
-                </div>
-                
-                <p style="color: #555; line-height: 1.6;">Enter this OTP in the authentication portal to complete your login.</p>
-                
-                <div class="footer">
-                    <p style="margin: 5px 0;"><strong>KIET Group of Institutions</strong></p>
-                    <p style="margin: 5px 0; color: #888;">Delhi-NCR, Ghaziabad, Uttar Pradesh</p>
-                    <p style="margin: 10px 0; font-size: 11px; color: #999;">This is an automated message. Please do not reply.</p>
-                    <p style="margin: 5px 0; font-size: 11px; color: #999;">Time: %s</p>
-                </div>
-            </div>
-        </div>
-    </body>
-    </html>
-    `, otp, time.Now().Format("2006-01-02 15:04:05"))
-    
-    // Plain text version for email clients that don't support HTML
-    textContent := fmt.Sprintf(`
-KIET Authentication System
-==========================
-
-Your One-Time Password (OTP) is: %s
-
-This OTP is valid for 10 minutes.
-
-SECURITY NOTICE:
-• Do NOT share this OTP with anyone
-• KIET staff will never ask for your OTP
-• If you didn't request this, please ignore this email
-
-Enter this OTP in the authentication portal to complete your login.
-
----
-KIET Group of Institutions
-Delhi-NCR, Ghaziabad, Uttar Pradesh
-
-This is an automated message. Please do not reply.
-Time: %s
-`, otp, time.Now().Format("2006-01-02 15:04:05"))
-    
     // Create Resend API request
     payload := map[string]interface{}{
-        "from":    "KIET Authentication <" + from + ">",
+        "from":    brand.ProductName + " <" + from + ">",
         "to":      []string{to},
-        "subject": "Your KIET Authentication OTP",
-        "html":    htmlContent,
-        "text":    textContent,
-        "reply_to": "no-reply@kiet.edu",
+        "subject": msg.Subject,
+        "html":    msg.HTML,
+        "text":    msg.Text,
+    }
+    if brand.ReplyTo != "" {
+        payload["reply_to"] = brand.ReplyTo
     }
     
     jsonData, err := json.Marshal(payload)
     if err != nil {
-        log.Printf("❌ Error marshaling email data: %v", err)
-        return es.simulateEmail(to, otp)
+        return fmt.Errorf("marshaling email: %w", err)
     }
     
     // Send request to Resend API
-    req, err := http.NewRequest("POST", "https://api.resend.com/emails", 
+    req, err := http.NewRequestWithContext(ctx, "POST", es.endpoint,
                                 bytes.NewBuffer(jsonData))
     if err != nil {
-        log.Printf("❌ Error creating HTTP request: %v", err)
-        return es.simulateEmail(to, otp)
+        return fmt.Errorf("creating Resend request: %w", err)
     }
     
     req.Header.Set("Authorization", "Bearer "+apiKey)
     req.Header.Set("Content-Type", "application/json")
     
     client := &http.Client{Timeout: 10 * time.Second}
+    start := time.Now()
     resp, err := client.Do(req)
+    metrics.EmailDuration.WithLabelValues("resend").Observe(time.Since(start).Seconds())
     if err != nil {
-        log.Printf("❌ Error sending email via Resend: %v", err)
-        return es.simulateEmail(to, otp)
+        metrics.EmailSends.WithLabelValues("resend", "failed").Inc()
+        return fmt.Errorf("sending email via Resend: %w", err)
     }
     defer resp.Body.Close()
     
     // Parse response
     var result map[string]interface{}
     if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-        log.Printf("❌ Error parsing Resend response: %v", err)
+        slog.WarnContext(ctx, "failed to parse Resend response", "error", err)
     }
     
     if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-        log.Printf("✅ Email sent successfully via Resend to: %s", to)
-        log.Printf("   Resend ID: %v", result["id"])
+        metrics.EmailSends.WithLabelValues("resend", "sent").Inc()
+        slog.InfoContext(ctx, "email sent via Resend", "to", to, "resend_id", result["id"])
         return nil
     }
     
     // Resend API error
-    log.Printf("❌ Resend API error (Status: %d): %v", resp.StatusCode, result)
-    return es.simulateEmail(to, otp)
+    metrics.EmailSends.WithLabelValues("resend", "failed").Inc()
+    return fmt.Errorf("Resend API error (status %d): %v", resp.StatusCode, result)
 }
 
-func (es *EmailService) simulateEmail(to, otp string) error {
-    log.Printf("📧 [SIMULATION] OTP for %s: %s", to, otp)
+func (es *EmailService) simulateEmail(ctx context.Context, to string, msg *RenderedEmail) error {
+    slog.InfoContext(ctx, "simulated email", "to", to, "subject", msg.Subject)
+    metrics.EmailSends.WithLabelValues("simulation", "sent").Inc()
     
     border := strings.Repeat("═", 60)
     
@@ -190,8 +202,8 @@ func (es *EmailService) simulateEmail(to, otp string) error {
     fmt.Println("📧 EMAIL SIMULATION MODE")
     fmt.Println(border)
     fmt.Printf("To: %s\n", to)
-    fmt.Printf("OTP: %s\n", otp)
-    fmt.Printf("Valid until: %s\n", time.Now().Add(10*time.Minute).Format("15:04:05"))
+    fmt.Printf("Subject: %s\n\n", msg.Subject)
+    fmt.Print(msg.Text)
     fmt.Println(border + "\n")
     
     return nil
@@ -0,0 +1,73 @@
+package services
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+// captureStdout returns what fn printed to stdout
+func captureStdout(t *testing.T, fn func()) string {
+    t.Helper()
+
+    r, w, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    stdout := os.Stdout
+    os.Stdout = w
+    defer func() { os.Stdout = stdout }()
+
+    fn()
+
+    w.Close()
+    out, _ := io.ReadAll(r)
+    return string(out)
+}
+
+func TestSendOTPEmailNeverPrintsOutsideSimulation(t *testing.T) {
+    failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusInternalServerError)
+        w.Write([]byte(`{"message":"internal error"}`))
+    }))
+    defer failing.Close()
+
+    const link = "https://auth.example.edu/auth/magic-link?token=secret-token"
+
+    tests := []struct {
+        name      string
+        cfg       config.EmailConfig
+        wantErr   bool
+        wantPrint bool
+    }{
+        {"simulation prints the email", config.EmailConfig{Provider: "simulation", From: "auth@example.edu"}, false, true},
+        {"resend failure is reported", config.EmailConfig{Provider: "resend", From: "auth@example.edu", ResendAPIKey: "re_test"}, true, false},
+        {"resend without a key is reported", config.EmailConfig{Provider: "resend", From: "auth@example.edu"}, true, false},
+        {"unknown provider is reported", config.EmailConfig{Provider: "smtp", From: "auth@example.edu"}, true, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            es := &EmailService{cfg: tt.cfg, templates: NewEmailTemplates("", nil), endpoint: failing.URL}
+
+            var err error
+            out := captureStdout(t, func() {
+                err = es.SendOTPEmail(context.Background(), "student@kiet.edu", "123456", "en", link, 10*time.Minute)
+            })
+
+            if (err != nil) != tt.wantErr {
+                t.Errorf("SendOTPEmail() error = %v, want error %v", err, tt.wantErr)
+            }
+            if printed := strings.Contains(out, "123456") || strings.Contains(out, "secret-token"); printed != tt.wantPrint {
+                t.Errorf("printed the code or link = %v, want %v; output:\n%s", printed, tt.wantPrint, out)
+            }
+        })
+    }
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+    "bytes"
+    "embed"
+    "encoding/json"
+    "fmt"
+    htmltemplate "html/template"
+    "io/fs"
+    "log/slog"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    texttemplate "text/template"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// Email template names. Each one has a <name>.html and <name>.txt file per
+// locale; the .txt file also defines the "subject" block.
+const (
+    TemplateOTP              = "otp"
+    TemplateNewDevice        = "new_device"
+    TemplateAccountSuspended = "account_suspended"
+    TemplateWelcome          = "welcome"
+    TemplateRecoveryCodeUsed = "recovery_code_used"
+)
+
+const DefaultLocale = "en"
+
+// SupportedLocales lists the locales we ship templates for.
+var SupportedLocales = []string{"en", "hi"}
+
+// Branding holds the per-tenant variables available to every template as .Brand
+type Branding struct {
+    ProductName  string `json:"product_name"`
+    OrgName      string `json:"org_name"`
+    OrgShortName string `json:"org_short_name"`
+    OrgAddress   string `json:"org_address"`
+    AudienceName string `json:"audience_name"`
+    PrimaryColor string `json:"primary_color"`
+    AccentColor  string `json:"accent_color"`
+    LogoURL      string `json:"logo_url"`
+    SupportEmail string `json:"support_email"`
+    ReplyTo      string `json:"reply_to"`
+}
+
+var defaultBranding = Branding{
+    ProductName:  "KIET Authentication",
+    OrgName:      "KIET Group of Institutions",
+    OrgShortName: "KIET",
+    OrgAddress:   "Delhi-NCR, Ghaziabad, Uttar Pradesh",
+    AudienceName: "KIET Student",
+    PrimaryColor: "#667eea",
+    AccentColor:  "#764ba2",
+    ReplyTo:      "no-reply@kiet.edu",
+}
+
+// DeviceInfo describes the device in a new-device alert
+type DeviceInfo struct {
+    IPAddress string
+    UserAgent string
+}
+
+// TemplateData is what every email template is executed with
+type TemplateData struct {
+    Brand            Branding
+    Locale           string
+    Recipient        string
+    Name             string
+    Time             string
+    OTP              string
+    ExpiresInMinutes int
+    MagicLink        string
+    Device           DeviceInfo
+    Reason           string
+
+    RecoveryCodesRemaining int
+}
+
+// RenderedEmail is a fully rendered message ready to hand to a provider
+type RenderedEmail struct {
+    Subject string
+    HTML    string
+    Text    string
+}
+
+// EmailTemplates renders emails from html/template and text/template files.
+// Files in dir (email.template_dir) take precedence over the embedded
+// defaults, so operators can override a single template without copying
+// the whole set.
+type EmailTemplates struct {
+    fsys     fs.FS
+    branding map[string]Branding
+
+    mu    sync.Mutex
+    cache map[string]*parsedTemplate
+}
+
+type parsedTemplate struct {
+    html *htmltemplate.Template
+    text *texttemplate.Template
+}
+
+var (
+    sharedTemplates     *EmailTemplates
+    sharedTemplatesOnce sync.Once
+)
+
+// DefaultEmailTemplates returns the process-wide template set loaded from
+// cfg's template directory and branding file. They are read on the first
+// call only, as configuration doesn't change while the process runs.
+func DefaultEmailTemplates(cfg config.EmailConfig) *EmailTemplates {
+    sharedTemplatesOnce.Do(func() {
+        branding, err := loadBranding(cfg.BrandingFile)
+        if err != nil {
+            slog.Warn("could not load email branding, using defaults", "error", err)
+        }
+        sharedTemplates = NewEmailTemplates(cfg.TemplateDir, branding)
+    })
+    return sharedTemplates
+}
+
+func NewEmailTemplates(dir string, branding map[string]Branding) *EmailTemplates {
+    embedded, _ := fs.Sub(embeddedTemplates, "templates")
+
+    var fsys fs.FS = embedded
+    if dir != "" {
+        fsys = overlayFS{upper: os.DirFS(dir), lower: embedded}
+    }
+
+    return &EmailTemplates{
+        fsys:     fsys,
+        branding: branding,
+        cache:    make(map[string]*parsedTemplate),
+    }
+}
+
+// BrandingFor returns the branding for the tenant owning email. Tenants are
+// keyed by email domain; anything not listed falls back to "default".
+func (t *EmailTemplates) BrandingFor(email string) Branding {
+    brand := defaultBranding
+    if b, ok := t.branding["default"]; ok {
+        brand = mergeBranding(brand, b)
+    }
+
+    if at := strings.LastIndex(email, "@"); at >= 0 {
+        domain := strings.ToLower(email[at+1:])
+        if b, ok := t.branding[domain]; ok {
+            brand = mergeBranding(brand, b)
+        }
+    }
+
+    return brand
+}
+
+// Render executes the named template for locale, falling back to the
+// default locale when the requested one has no translation.
+func (t *EmailTemplates) Render(name, locale string, data TemplateData) (*RenderedEmail, error) {
+    if !IsSupportedLocale(locale) {
+        locale = DefaultLocale
+    }
+    data.Locale = locale
+
+    tmpl, err := t.lookup(name, locale)
+    if err != nil && locale != DefaultLocale {
+        tmpl, err = t.lookup(name, DefaultLocale)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    var subject, text, html bytes.Buffer
+    if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+        return nil, fmt.Errorf("render %s subject: %w", name, err)
+    }
+    if err := tmpl.text.ExecuteTemplate(&text, "layout", data); err != nil {
+        return nil, fmt.Errorf("render %s text: %w", name, err)
+    }
+    if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+        return nil, fmt.Errorf("render %s html: %w", name, err)
+    }
+
+    return &RenderedEmail{
+        Subject: strings.TrimSpace(subject.String()),
+        HTML:    html.String(),
+        Text:    strings.TrimSpace(text.String()) + "\n",
+    }, nil
+}
+
+func (t *EmailTemplates) lookup(name, locale string) (*parsedTemplate, error) {
+    key := locale + "/" + name
+
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    if tmpl, ok := t.cache[key]; ok {
+        return tmpl, nil
+    }
+
+    htmlTmpl, err := htmltemplate.ParseFS(t.fsys, "layout.html", locale+"/common.tmpl", key+".html")
+    if err != nil {
+        return nil, fmt.Errorf("load %s.html: %w", key, err)
+    }
+    textTmpl, err := texttemplate.ParseFS(t.fsys, "layout.txt", locale+"/common.tmpl", key+".txt")
+    if err != nil {
+        return nil, fmt.Errorf("load %s.txt: %w", key, err)
+    }
+
+    tmpl := &parsedTemplate{html: htmlTmpl, text: textTmpl}
+    t.cache[key] = tmpl
+    return tmpl, nil
+}
+
+// IsSupportedLocale reports whether we have templates for locale
+func IsSupportedLocale(locale string) bool {
+    for _, l := range SupportedLocales {
+        if l == locale {
+            return true
+        }
+    }
+    return false
+}
+
+// ResolveLocale picks the email locale from the user's saved preference,
+// then the request's Accept-Language header, then the default.
+func ResolveLocale(preferred, acceptLanguage string) string {
+    if IsSupportedLocale(preferred) {
+        return preferred
+    }
+
+    best, bestQ := "", 0.0
+    for _, part := range strings.Split(acceptLanguage, ",") {
+        fields := strings.Split(strings.TrimSpace(part), ";")
+        tag := strings.ToLower(strings.TrimSpace(fields[0]))
+        if i := strings.IndexAny(tag, "-_"); i >= 0 {
+            tag = tag[:i]
+        }
+
+        q := 1.0
+        for _, param := range fields[1:] {
+            param = strings.TrimSpace(param)
+            if strings.HasPrefix(param, "q=") {
+                if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+                    q = v
+                }
+            }
+        }
+
+        if IsSupportedLocale(tag) && q > bestQ {
+            best, bestQ = tag, q
+        }
+    }
+
+    if best != "" {
+        return best
+    }
+    return DefaultLocale
+}
+
+// loadBranding reads a JSON object mapping "default" or an email domain to
+// branding overrides. Missing fields inherit from the built-in defaults.
+func loadBranding(path string) (map[string]Branding, error) {
+    if path == "" {
+        return nil, nil
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var branding map[string]Branding
+    if err := json.Unmarshal(data, &branding); err != nil {
+        return nil, fmt.Errorf("parse %s: %w", path, err)
+    }
+    return branding, nil
+}
+
+func mergeBranding(base, override Branding) Branding {
+    set := func(dst *string, src string) {
+        if src != "" {
+            *dst = src
+        }
+    }
+
+    set(&base.ProductName, override.ProductName)
+    set(&base.OrgName, override.OrgName)
+    set(&base.OrgShortName, override.OrgShortName)
+    set(&base.OrgAddress, override.OrgAddress)
+    set(&base.AudienceName, override.AudienceName)
+    set(&base.PrimaryColor, override.PrimaryColor)
+    set(&base.AccentColor, override.AccentColor)
+    set(&base.LogoURL, override.LogoURL)
+    set(&base.SupportEmail, override.SupportEmail)
+    set(&base.ReplyTo, override.ReplyTo)
+    return base
+}
+
+// overlayFS serves files from upper when present and from lower otherwise
+type overlayFS struct {
+    upper fs.FS
+    lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+    if f, err := o.upper.Open(name); err == nil {
+        return f, nil
+    }
+    return o.lower.Open(name)
+}
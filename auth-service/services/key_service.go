@@ -0,0 +1,230 @@
+package services
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "log/slog"
+    "math/big"
+    "sync"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+)
+
+// How long a loaded key set is trusted before re-reading signing_keys, so
+// a rotation done by another instance is picked up without a restart
+const keyCacheTTL = time.Minute
+
+// JWK is the public half of a signing key as published at the JWKS endpoint
+type JWK struct {
+    KeyType   string `json:"kty"`
+    Use       string `json:"use"`
+    Algorithm string `json:"alg"`
+    KeyID     string `json:"kid"`
+    Modulus   string `json:"n"`
+    Exponent  string `json:"e"`
+}
+
+type signingKey struct {
+    id     string
+    key    *rsa.PrivateKey
+    active bool
+}
+
+// KeyService manages the RSA keys that sign ID tokens. Keys are stored in
+// the signing_keys collection so every instance signs with the same key.
+type KeyService struct{}
+
+var (
+    keyCacheMu     sync.Mutex
+    keyCache       []signingKey
+    keyCacheLoaded time.Time
+)
+
+func NewKeyService() *KeyService {
+    return &KeyService{}
+}
+
+// Sign signs claims with the active key, creating one on first use
+func (ks *KeyService) Sign(claims jwt.Claims) (string, error) {
+    key, err := ks.activeKey()
+    if err != nil {
+        return "", err
+    }
+
+    token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+    token.Header["kid"] = key.id
+    return token.SignedString(key.key)
+}
+
+// PublicKey returns the public key for kid, for verifying tokens we issued
+func (ks *KeyService) PublicKey(kid string) (*rsa.PublicKey, error) {
+    keys, err := ks.keys()
+    if err != nil {
+        return nil, err
+    }
+    for _, k := range keys {
+        if k.id == kid {
+            return &k.key.PublicKey, nil
+        }
+    }
+    return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKS returns every published key, active or retired
+func (ks *KeyService) JWKS() ([]JWK, error) {
+    if _, err := ks.activeKey(); err != nil {
+        return nil, err
+    }
+
+    keys, err := ks.keys()
+    if err != nil {
+        return nil, err
+    }
+
+    jwks := make([]JWK, len(keys))
+    for i, k := range keys {
+        jwks[i] = JWK{
+            KeyType:   "RSA",
+            Use:       "sig",
+            Algorithm: "RS256",
+            KeyID:     k.id,
+            Modulus:   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+            Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+        }
+    }
+    return jwks, nil
+}
+
+// Rotate generates a new active key. The previous keys are kept, inactive,
+// so tokens they signed keep verifying until they expire.
+func (ks *KeyService) Rotate() (string, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        return "", err
+    }
+
+    der := x509.MarshalPKCS1PrivateKey(key)
+    sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+    kid := base64.RawURLEncoding.EncodeToString(sum[:12])
+    createdAt := time.Now()
+
+    _, err = config.SigningKeyCollection.InsertOne(ctx, models.SigningKey{
+        KeyID:         kid,
+        Algorithm:     "RS256",
+        PrivateKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})),
+        Active:        true,
+        CreatedAt:     createdAt,
+    })
+    if err != nil {
+        return "", err
+    }
+
+    // Only retire keys older than this one. Instances rotating at the same
+    // time (or all creating their first key on a fresh database) then leave
+    // the newest key active instead of retiring each other's.
+    _, err = config.SigningKeyCollection.UpdateMany(ctx,
+        bson.M{"_id": bson.M{"$ne": kid}, "active": true, "created_at": bson.M{"$lt": createdAt}},
+        bson.M{"$set": bson.M{"active": false}},
+    )
+    if err != nil {
+        return "", err
+    }
+
+    invalidateKeyCache()
+    slog.Info("rotated ID token signing key", "kid", kid)
+    return kid, nil
+}
+
+func (ks *KeyService) activeKey() (*signingKey, error) {
+    keys, err := ks.keys()
+    if err != nil {
+        return nil, err
+    }
+    for i := range keys {
+        if keys[i].active {
+            return &keys[i], nil
+        }
+    }
+
+    // First start: nothing to sign with yet
+    if _, err := ks.Rotate(); err != nil {
+        return nil, err
+    }
+
+    keys, err = ks.keys()
+    if err != nil {
+        return nil, err
+    }
+    for i := range keys {
+        if keys[i].active {
+            return &keys[i], nil
+        }
+    }
+    return nil, errors.New("no active signing key")
+}
+
+func (ks *KeyService) keys() ([]signingKey, error) {
+    keyCacheMu.Lock()
+    defer keyCacheMu.Unlock()
+
+    if keyCache != nil && time.Since(keyCacheLoaded) < keyCacheTTL {
+        return keyCache, nil
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    // Newest first, so the most recent active key wins if two are marked
+    // active during a concurrent rotation
+    cursor, err := config.SigningKeyCollection.Find(ctx, bson.M{},
+        options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+    if err != nil {
+        return nil, err
+    }
+
+    var stored []models.SigningKey
+    if err := cursor.All(ctx, &stored); err != nil {
+        return nil, err
+    }
+
+    keys := make([]signingKey, 0, len(stored))
+    for _, s := range stored {
+        block, _ := pem.Decode([]byte(s.PrivateKeyPEM))
+        if block == nil {
+            slog.Warn("skipping unreadable signing key", "kid", s.KeyID)
+            continue
+        }
+        key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+        if err != nil {
+            slog.Warn("skipping unreadable signing key", "kid", s.KeyID, "error", err)
+            continue
+        }
+        keys = append(keys, signingKey{id: s.KeyID, key: key, active: s.Active})
+    }
+
+    keyCache = keys
+    keyCacheLoaded = time.Now()
+    return keys, nil
+}
+
+func invalidateKeyCache() {
+    keyCacheMu.Lock()
+    defer keyCacheMu.Unlock()
+    keyCache = nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+var (
+    // ErrOTPInvalid covers wrong, expired, already used and never issued codes
+    ErrOTPInvalid = errors.New("invalid or expired OTP")
+    // ErrOTPTooManyAttempts means the challenge was thrown away after too
+    // many wrong guesses and a new code has to be requested
+    ErrOTPTooManyAttempts = errors.New("too many OTP attempts")
+)
+
+// OTPService stores pending one-time codes as challenges, one per user and
+// purpose. Only a keyed hash of each code is kept.
+type OTPService struct {
+    jwt config.JWTConfig
+}
+
+// NewOTPService keys code hashes from the secrets in jwtCfg
+func NewOTPService(jwtCfg config.JWTConfig) *OTPService {
+    return &OTPService{jwt: jwtCfg}
+}
+
+// Issue replaces the user's pending challenge for purpose with a new code,
+// resetting the attempt count. magicLinkNonce is optional.
+func (ots *OTPService) Issue(ctx context.Context, user *models.User, purpose, code, magicLinkNonce string, expiresAt time.Time) error {
+    _, err := config.OTPChallengeCollection.UpdateOne(ctx,
+        bson.M{"user_id": user.ID, "purpose": purpose},
+        bson.M{"$set": bson.M{
+            "email":            user.Email,
+            "code_hash":        utils.HashOTP(ots.jwt, code),
+            "attempts":         0,
+            "magic_link_nonce": magicLinkNonce,
+            "expires_at":       expiresAt,
+            "created_at":       time.Now(),
+        }},
+        options.Update().SetUpsert(true),
+    )
+    return err
+}
+
+// Verify checks code against the user's pending challenge and consumes the
+// challenge if it matches. Every call uses up an attempt before the code is
+// compared, so parallel guesses can't get past maxAttempts.
+func (ots *OTPService) Verify(ctx context.Context, userID primitive.ObjectID, purpose, code string, maxAttempts int) error {
+    var challenge models.OTPChallenge
+    err := config.OTPChallengeCollection.FindOneAndUpdate(ctx,
+        bson.M{
+            "user_id":    userID,
+            "purpose":    purpose,
+            "expires_at": bson.M{"$gt": time.Now()},
+        },
+        bson.M{"$inc": bson.M{"attempts": 1}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After),
+    ).Decode(&challenge)
+    if err == mongo.ErrNoDocuments {
+        return ErrOTPInvalid
+    }
+    if err != nil {
+        return err
+    }
+
+    if challenge.Attempts > maxAttempts {
+        if _, err := config.OTPChallengeCollection.DeleteOne(ctx, bson.M{"_id": challenge.ID}); err != nil {
+            return err
+        }
+        return ErrOTPTooManyAttempts
+    }
+
+    if !utils.IsOTPValid(ots.jwt, challenge.CodeHash, code, challenge.ExpiresAt) {
+        return ErrOTPInvalid
+    }
+
+    // Matching on the hash as well loses the race against a concurrent
+    // verification or a newly issued code
+    result, err := config.OTPChallengeCollection.DeleteOne(ctx, bson.M{
+        "_id":       challenge.ID,
+        "code_hash": challenge.CodeHash,
+    })
+    if err != nil {
+        return err
+    }
+    if result.DeletedCount == 0 {
+        return ErrOTPInvalid
+    }
+    return nil
+}
+
+// RedeemMagicLink consumes the user's pending login challenge if nonce is the
+// one its magic link was issued with. The link and the code are one
+// challenge, so using either ends both.
+func (ots *OTPService) RedeemMagicLink(ctx context.Context, userID primitive.ObjectID, nonce string) error {
+    if nonce == "" {
+        return ErrOTPInvalid
+    }
+
+    err := config.OTPChallengeCollection.FindOneAndDelete(ctx, bson.M{
+        "user_id":          userID,
+        "purpose":          models.OTPPurposeLogin,
+        "magic_link_nonce": nonce,
+        "expires_at":       bson.M{"$gt": time.Now()},
+    }).Err()
+    if err == mongo.ErrNoDocuments {
+        return ErrOTPInvalid
+    }
+    return err
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+)
+
+func TestOTPVerify(t *testing.T) {
+    testDB(t)
+
+    ots := NewOTPService(config.JWTConfig{AccessSecret: strings.Repeat("a", 32)})
+    ctx := context.Background()
+    const maxAttempts = 3
+
+    issue := func(t *testing.T, user *models.User, code string) {
+        t.Helper()
+        if err := ots.Issue(ctx, user, models.OTPPurposeLogin, code, "", time.Now().Add(5*time.Minute)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    newUser := func() *models.User {
+        return &models.User{ID: primitive.NewObjectID(), Email: "student@kiet.edu"}
+    }
+    verify := func(user *models.User, code string) error {
+        return ots.Verify(ctx, user.ID, models.OTPPurposeLogin, code, maxAttempts)
+    }
+    challenges := func(t *testing.T, user *models.User) int64 {
+        t.Helper()
+        n, err := config.OTPChallengeCollection.CountDocuments(ctx, bson.M{"user_id": user.ID})
+        if err != nil {
+            t.Fatal(err)
+        }
+        return n
+    }
+
+    t.Run("a correct code is consumed once", func(t *testing.T) {
+        user := newUser()
+        issue(t, user, "123456")
+
+        if err := verify(user, "123456"); err != nil {
+            t.Fatalf("first verification: %v", err)
+        }
+        if err := verify(user, "123456"); !errors.Is(err, ErrOTPInvalid) {
+            t.Errorf("second verification error = %v, want ErrOTPInvalid", err)
+        }
+    })
+
+    t.Run("wrong guesses use up the attempts", func(t *testing.T) {
+        user := newUser()
+        issue(t, user, "123456")
+
+        for i := 0; i < maxAttempts; i++ {
+            if err := verify(user, "000000"); !errors.Is(err, ErrOTPInvalid) {
+                t.Fatalf("guess %d error = %v, want ErrOTPInvalid", i+1, err)
+            }
+        }
+
+        // The right code no longer helps once the attempts are gone
+        if err := verify(user, "123456"); !errors.Is(err, ErrOTPTooManyAttempts) {
+            t.Fatalf("verification after %d wrong guesses error = %v, want ErrOTPTooManyAttempts", maxAttempts, err)
+        }
+        if n := challenges(t, user); n != 0 {
+            t.Errorf("%d challenges left after too many attempts, want 0", n)
+        }
+        if err := verify(user, "123456"); !errors.Is(err, ErrOTPInvalid) {
+            t.Errorf("verification after the challenge was dropped error = %v, want ErrOTPInvalid", err)
+        }
+    })
+
+    t.Run("parallel guesses all count", func(t *testing.T) {
+        user := newUser()
+        issue(t, user, "123456")
+
+        var wg sync.WaitGroup
+        for i := 0; i < maxAttempts; i++ {
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                verify(user, "000000")
+            }()
+        }
+        wg.Wait()
+
+        // No guess may have been lost, so the budget is now spent. This
+        // relies on the server applying $inc atomically, as MongoDB does.
+        if err := verify(user, "123456"); !errors.Is(err, ErrOTPTooManyAttempts) {
+            t.Errorf("right code after %d parallel wrong guesses error = %v, want ErrOTPTooManyAttempts", maxAttempts, err)
+        }
+    })
+
+    t.Run("issuing a new code resets the attempts", func(t *testing.T) {
+        user := newUser()
+        issue(t, user, "123456")
+
+        for i := 0; i < maxAttempts; i++ {
+            verify(user, "000000")
+        }
+        issue(t, user, "654321")
+
+        if n := challenges(t, user); n != 1 {
+            t.Fatalf("%d challenges after reissuing, want 1", n)
+        }
+        if err := verify(user, "123456"); !errors.Is(err, ErrOTPInvalid) {
+            t.Errorf("old code error = %v, want ErrOTPInvalid", err)
+        }
+        if err := verify(user, "654321"); err != nil {
+            t.Errorf("new code after reissuing: %v", err)
+        }
+    })
+
+    t.Run("an expired code is invalid", func(t *testing.T) {
+        user := newUser()
+        if err := ots.Issue(ctx, user, models.OTPPurposeLogin, "123456", "", time.Now().Add(-time.Second)); err != nil {
+            t.Fatal(err)
+        }
+
+        if err := verify(user, "123456"); !errors.Is(err, ErrOTPInvalid) {
+            t.Errorf("expired code error = %v, want ErrOTPInvalid", err)
+        }
+    })
+}
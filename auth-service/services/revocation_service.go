@@ -0,0 +1,54 @@
+package services
+
+import (
+    "context"
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+// RevocationService keeps the denylist of revoked token IDs (jti). Entries
+// expire with the tokens they block.
+type RevocationService struct{}
+
+func NewRevocationService() *RevocationService {
+    return &RevocationService{}
+}
+
+// Revoke denylists tokenID until expiresAt. Revoking twice is harmless.
+func (rs *RevocationService) Revoke(ctx context.Context, tokenID, clientID, reason string, expiresAt time.Time) error {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    _, err := config.RevokedTokenCollection.UpdateOne(ctx,
+        bson.M{"_id": tokenID},
+        bson.M{"$setOnInsert": bson.M{
+            "client_id":  clientID,
+            "reason":     reason,
+            "revoked_at": time.Now(),
+            "expires_at": expiresAt,
+        }},
+        options.Update().SetUpsert(true),
+    )
+    return err
+}
+
+// IsRevoked reports whether tokenID is denylisted. Lookup failures are
+// reported as errors so callers can fail closed.
+func (rs *RevocationService) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+
+    err := config.RevokedTokenCollection.FindOne(ctx, bson.M{"_id": tokenID}).Err()
+    if err == mongo.ErrNoDocuments {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return true, nil
+}
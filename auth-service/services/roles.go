@@ -0,0 +1,23 @@
+package services
+
+import (
+    "strings"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+)
+
+// IsAdmin reports whether user has the admin role or an email listed in
+// cfg.Emails, which is how the first admin gets in
+func IsAdmin(cfg config.AdminConfig, user *models.User) bool {
+    if user.Role == models.RoleAdmin {
+        return true
+    }
+
+    for _, email := range cfg.Emails {
+        if strings.EqualFold(email, user.Email) {
+            return true
+        }
+    }
+    return false
+}
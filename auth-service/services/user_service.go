@@ -0,0 +1,222 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "time"
+
+    "github.com/golang-jwt/jwt/v5"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+// ErrUserNotFound is returned when no user matches an email or ID
+var ErrUserNotFound = errors.New("user not found")
+
+// Session is a user's current refresh token, described by its claims
+type Session struct {
+    UserID    primitive.ObjectID
+    Email     string
+    TokenID   string
+    IssuedAt  time.Time
+    ExpiresAt time.Time
+}
+
+// UserService is account administration for operators: the things the API
+// only does as a side effect of users logging in
+type UserService struct {
+    jwt config.JWTConfig
+}
+
+// NewUserService reads sessions from refresh tokens signed with the
+// secrets in jwtCfg
+func NewUserService(jwtCfg config.JWTConfig) *UserService {
+    return &UserService{jwt: jwtCfg}
+}
+
+// Find looks a user up by email, or by ID when ref is an ObjectID in hex
+func (us *UserService) Find(ctx context.Context, ref string) (*models.User, error) {
+    filter := bson.M{"email": ref}
+    if objID, err := primitive.ObjectIDFromHex(ref); err == nil {
+        filter = bson.M{"_id": objID}
+    }
+
+    var user models.User
+    err := config.UserCollection.FindOne(ctx, filter).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        return nil, ErrUserNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+// Create inserts user, filling in its ID and creation time
+func (us *UserService) Create(ctx context.Context, user *models.User) error {
+    user.ID = primitive.NewObjectID()
+    user.CreatedAt = time.Now()
+
+    if _, err := config.UserCollection.InsertOne(ctx, user); err != nil {
+        return err
+    }
+
+    NewAuditService().Record(ctx, models.AuditEvent{
+        Type:   models.AuditUserCreated,
+        UserID: user.ID,
+    })
+    return nil
+}
+
+// Suspend stops user from logging in and ends their session. Access tokens
+// already issued are refused by the auth middleware, which checks the flag
+// on every request.
+func (us *UserService) Suspend(ctx context.Context, user *models.User, reason string) error {
+    if err := us.RevokeSession(ctx, user, "suspended"); err != nil {
+        return err
+    }
+
+    _, err := config.UserCollection.UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$set": bson.M{"suspended": true, "suspended_at": time.Now()}},
+    )
+    if err != nil {
+        return err
+    }
+
+    NewAuditService().Record(ctx, models.AuditEvent{
+        Type:    models.AuditUserSuspended,
+        UserID:  user.ID,
+        Details: map[string]interface{}{"reason": reason},
+    })
+    return nil
+}
+
+// Unsuspend lets a suspended user log in again
+func (us *UserService) Unsuspend(ctx context.Context, user *models.User) error {
+    _, err := config.UserCollection.UpdateOne(ctx,
+        bson.M{"_id": user.ID},
+        bson.M{"$unset": bson.M{"suspended": "", "suspended_at": ""}},
+    )
+    if err != nil {
+        return err
+    }
+
+    NewAuditService().Record(ctx, models.AuditEvent{
+        Type:   models.AuditUserUnsuspended,
+        UserID: user.ID,
+    })
+    return nil
+}
+
+// Delete removes user along with their session and pending OTPs. The audit
+// trail is kept.
+func (us *UserService) Delete(ctx context.Context, user *models.User) error {
+    if err := us.RevokeSession(ctx, user, "deleted"); err != nil {
+        return err
+    }
+
+    if _, err := config.OTPChallengeCollection.DeleteMany(ctx, bson.M{"user_id": user.ID}); err != nil {
+        return err
+    }
+    if _, err := config.UserCollection.DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+        return err
+    }
+
+    NewAuditService().Record(ctx, models.AuditEvent{
+        Type:    models.AuditUserDeleted,
+        UserID:  user.ID,
+        Details: map[string]interface{}{"email": user.Email},
+    })
+    return nil
+}
+
+// Sessions lists current sessions, for one user or for everyone when
+// userID is nil. Each user has at most one, their stored refresh token.
+func (us *UserService) Sessions(ctx context.Context, userID *primitive.ObjectID) ([]Session, error) {
+    filter := bson.M{"refresh_token": bson.M{"$exists": true, "$ne": ""}}
+    if userID != nil {
+        filter["_id"] = *userID
+    }
+
+    cursor, err := config.UserCollection.Find(ctx, filter)
+    if err != nil {
+        return nil, err
+    }
+
+    var users []models.User
+    if err := cursor.All(ctx, &users); err != nil {
+        return nil, err
+    }
+
+    var sessions []Session
+    for _, user := range users {
+        session, ok := sessionFromToken(us.jwt, user.RefreshToken)
+        if !ok {
+            continue
+        }
+        session.UserID = user.ID
+        session.Email = user.Email
+        sessions = append(sessions, session)
+    }
+    return sessions, nil
+}
+
+// RevokeSession ends user's session: the refresh token is denylisted and
+// removed, so it can't be used to get new access tokens
+func (us *UserService) RevokeSession(ctx context.Context, user *models.User, reason string) error {
+    if user.RefreshToken == "" {
+        return nil
+    }
+
+    if session, ok := sessionFromToken(us.jwt, user.RefreshToken); ok && session.TokenID != "" {
+        if err := NewRevocationService().Revoke(ctx, session.TokenID, "", reason, session.ExpiresAt); err != nil {
+            return err
+        }
+    }
+
+    // Only unset the stored token if it is still this one, so a session
+    // started since is left alone
+    _, err := config.UserCollection.UpdateOne(ctx,
+        bson.M{"_id": user.ID, "refresh_token": user.RefreshToken},
+        bson.M{"$unset": bson.M{"refresh_token": ""}},
+    )
+    if err != nil {
+        return err
+    }
+
+    NewAuditService().Record(ctx, models.AuditEvent{
+        Type:    models.AuditSessionRevoked,
+        UserID:  user.ID,
+        Details: map[string]interface{}{"reason": reason},
+    })
+    return nil
+}
+
+// sessionFromToken reads the claims of a stored refresh token. Expired
+// tokens are not sessions any more.
+func sessionFromToken(jwtCfg config.JWTConfig, raw string) (Session, bool) {
+    token, err := utils.ParseToken(jwtCfg, raw, true)
+    if err != nil || !token.Valid {
+        return Session{}, false
+    }
+    claims, ok := token.Claims.(jwt.MapClaims)
+    if !ok {
+        return Session{}, false
+    }
+
+    var session Session
+    session.TokenID, _ = claims["jti"].(string)
+    if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+        session.IssuedAt = iat.Time
+    }
+    if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+        session.ExpiresAt = exp.Time
+    }
+    return session, true
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/go-webauthn/webauthn/protocol"
+    "github.com/go-webauthn/webauthn/webauthn"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/models"
+    "github.com/Anurag-spec1/goauthenticate/utils"
+)
+
+const (
+    webAuthnPurposeRegister = "register"
+    webAuthnPurposeLogin    = "login"
+
+    webAuthnSessionLifetime = 5 * time.Minute
+)
+
+var (
+    ErrWebAuthnSessionNotFound      = errors.New("passkey session not found or expired")
+    ErrWebAuthnCloneDetected        = errors.New("passkey signature counter went backwards")
+    ErrWebAuthnSecondFactorRequired = errors.New("passkey registration was not confirmed with a second factor")
+)
+
+// WebAuthnService runs passkey registration and login ceremonies. Ceremony
+// state lives in the webauthn_sessions collection so any instance can
+// finish a ceremony another one started.
+type WebAuthnService struct {
+    wa *webauthn.WebAuthn
+}
+
+// NewWebAuthnService acts as the relying party described by cfg
+func NewWebAuthnService(cfg config.WebAuthnConfig) (*WebAuthnService, error) {
+    rpName := cfg.RPName
+    if rpName == "" {
+        rpName = defaultBranding.ProductName
+    }
+
+    wa, err := webauthn.New(&webauthn.Config{
+        RPID:          cfg.RPID,
+        RPDisplayName: rpName,
+        RPOrigins:     cfg.RPOrigins,
+        AuthenticatorSelection: protocol.AuthenticatorSelection{
+            ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+            UserVerification: protocol.VerificationPreferred,
+        },
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &WebAuthnService{wa: wa}, nil
+}
+
+// BeginRegistration returns the options for navigator.credentials.create
+// and the ID of the session to pass back to FinishRegistration.
+// secondFactor records that the caller checked the user's second factor.
+func (ws *WebAuthnService) BeginRegistration(ctx context.Context, user *models.User, secondFactor bool) (*protocol.CredentialCreation, string, error) {
+    wu := webAuthnUser{user}
+
+    creation, session, err := ws.wa.BeginRegistration(wu,
+        webauthn.WithExclusions(webauthn.Credentials(wu.WebAuthnCredentials()).CredentialDescriptors()),
+    )
+    if err != nil {
+        return nil, "", err
+    }
+
+    sessionID, err := ws.saveSession(ctx, webAuthnPurposeRegister, user.ID, session, secondFactor)
+    if err != nil {
+        return nil, "", err
+    }
+    return creation, sessionID, nil
+}
+
+// FinishRegistration verifies the attestation in r's body and returns the
+// new credential. The caller stores it on the user. Users with MFA enabled
+// can only finish a registration begun with their second factor.
+func (ws *WebAuthnService) FinishRegistration(ctx context.Context, user *models.User, sessionID, name string, r *http.Request) (*models.WebAuthnCredential, error) {
+    session, secondFactor, err := ws.takeSession(ctx, sessionID, webAuthnPurposeRegister, user.ID)
+    if err != nil {
+        return nil, err
+    }
+    if user.MFAEnabled && !secondFactor {
+        return nil, ErrWebAuthnSecondFactorRequired
+    }
+
+    credential, err := ws.wa.FinishRegistration(webAuthnUser{user}, *session, r)
+    if err != nil {
+        return nil, err
+    }
+
+    stored := fromLibraryCredential(credential)
+    stored.Name = name
+    stored.CreatedAt = time.Now()
+    return &stored, nil
+}
+
+// BeginLogin returns the options for navigator.credentials.get. With a
+// nil user it starts a discoverable (usernameless) passkey login.
+func (ws *WebAuthnService) BeginLogin(ctx context.Context, user *models.User) (*protocol.CredentialAssertion, string, error) {
+    var (
+        assertion *protocol.CredentialAssertion
+        session   *webauthn.SessionData
+        err       error
+        userID    primitive.ObjectID
+    )
+
+    if user != nil {
+        userID = user.ID
+        assertion, session, err = ws.wa.BeginLogin(webAuthnUser{user})
+    } else {
+        assertion, session, err = ws.wa.BeginDiscoverableLogin()
+    }
+    if err != nil {
+        return nil, "", err
+    }
+
+    sessionID, err := ws.saveSession(ctx, webAuthnPurposeLogin, userID, session, false)
+    if err != nil {
+        return nil, "", err
+    }
+    return assertion, sessionID, nil
+}
+
+// FinishLogin verifies the assertion in r's body and returns the user it
+// belongs to and the credential used, with its sign count already updated
+// in the database. A counter that fails to advance is treated as a cloned
+// authenticator and rejected.
+func (ws *WebAuthnService) FinishLogin(ctx context.Context, sessionID string, r *http.Request) (*models.User, *models.WebAuthnCredential, error) {
+    session, _, err := ws.takeSession(ctx, sessionID, webAuthnPurposeLogin, primitive.NilObjectID)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var (
+        user       *models.User
+        credential *webauthn.Credential
+    )
+
+    if len(session.UserID) > 0 {
+        user, err = findUserByWebAuthnHandle(ctx, session.UserID)
+        if err != nil {
+            return nil, nil, err
+        }
+        credential, err = ws.wa.FinishLogin(webAuthnUser{user}, *session, r)
+    } else {
+        // Usernameless login: the authenticator tells us whose passkey it is
+        credential, err = ws.wa.FinishDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+            u, err := findUserByWebAuthnHandle(ctx, userHandle)
+            if err != nil {
+                return nil, err
+            }
+            user = u
+            return webAuthnUser{u}, nil
+        }, *session, r)
+    }
+    if err != nil {
+        return nil, nil, err
+    }
+
+    stored := fromLibraryCredential(credential)
+    if credential.Authenticator.CloneWarning {
+        return user, &stored, ErrWebAuthnCloneDetected
+    }
+
+    // Only move the counter forward. Two assertions from a cloned
+    // authenticator racing each other both pass the library's check
+    // against the count we loaded, but only one can update it. Passkeys
+    // that don't count always report 0 and are not compared.
+    match := bson.M{"credential_id": credential.ID}
+    if credential.Authenticator.SignCount > 0 {
+        match["sign_count"] = bson.M{"$lt": credential.Authenticator.SignCount}
+    }
+    result, err := config.UserCollection.UpdateOne(
+        ctx,
+        bson.M{"_id": user.ID, "webauthn_credentials": bson.M{"$elemMatch": match}},
+        bson.M{"$set": bson.M{
+            "webauthn_credentials.$.sign_count":   credential.Authenticator.SignCount,
+            "webauthn_credentials.$.flags":        stored.Flags,
+            "webauthn_credentials.$.last_used_at": time.Now(),
+        }},
+    )
+    if err != nil {
+        return nil, nil, err
+    }
+    if result.MatchedCount == 0 {
+        return user, &stored, ErrWebAuthnCloneDetected
+    }
+
+    return user, &stored, nil
+}
+
+func (ws *WebAuthnService) saveSession(ctx context.Context, purpose string, userID primitive.ObjectID, session *webauthn.SessionData, secondFactor bool) (string, error) {
+    data, err := json.Marshal(session)
+    if err != nil {
+        return "", err
+    }
+
+    id, err := utils.GenerateSecureToken(32)
+    if err != nil {
+        return "", err
+    }
+
+    _, err = config.WebAuthnSessionCollection.InsertOne(ctx, models.WebAuthnSession{
+        ID:        id,
+        Purpose:   purpose,
+        UserID:    userID,
+        Data:         string(data),
+        SecondFactor: secondFactor,
+        ExpiresAt:    time.Now().Add(webAuthnSessionLifetime),
+    })
+    if err != nil {
+        return "", err
+    }
+    return id, nil
+}
+
+// takeSession loads and deletes a ceremony session so each challenge can
+// only be answered once. It also reports whether the session was begun
+// after a second factor check.
+func (ws *WebAuthnService) takeSession(ctx context.Context, id, purpose string, userID primitive.ObjectID) (*webauthn.SessionData, bool, error) {
+    filter := bson.M{
+        "_id":        id,
+        "purpose":    purpose,
+        "expires_at": bson.M{"$gt": time.Now()},
+    }
+    if !userID.IsZero() {
+        filter["user_id"] = userID
+    }
+
+    var stored models.WebAuthnSession
+    err := config.WebAuthnSessionCollection.FindOneAndDelete(ctx, filter).Decode(&stored)
+    if err != nil {
+        return nil, false, ErrWebAuthnSessionNotFound
+    }
+
+    var session webauthn.SessionData
+    if err := json.Unmarshal([]byte(stored.Data), &session); err != nil {
+        return nil, false, err
+    }
+    return &session, stored.SecondFactor, nil
+}
+
+func findUserByWebAuthnHandle(ctx context.Context, handle []byte) (*models.User, error) {
+    if len(handle) != len(primitive.ObjectID{}) {
+        return nil, errors.New("unknown user handle")
+    }
+
+    var objID primitive.ObjectID
+    copy(objID[:], handle)
+
+    var user models.User
+    if err := config.UserCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user); err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+// webAuthnUser adapts models.User to the webauthn library's User interface.
+// The user handle is the raw ObjectID, which reveals nothing about the user.
+type webAuthnUser struct {
+    *models.User
+}
+
+func (u webAuthnUser) WebAuthnID() []byte {
+    return u.ID[:]
+}
+
+func (u webAuthnUser) WebAuthnName() string {
+    return u.Email
+}
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+    if u.Name != "" {
+        return u.Name
+    }
+    return u.Email
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+    credentials := make([]webauthn.Credential, len(u.User.WebAuthnCredentials))
+    for i, c := range u.User.WebAuthnCredentials {
+        credentials[i] = toLibraryCredential(c)
+    }
+    return credentials
+}
+
+func toLibraryCredential(c models.WebAuthnCredential) webauthn.Credential {
+    transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+    for i, t := range c.Transports {
+        transports[i] = protocol.AuthenticatorTransport(t)
+    }
+
+    return webauthn.Credential{
+        ID:                c.CredentialID,
+        PublicKey:         c.PublicKey,
+        AttestationType:   c.AttestationType,
+        AttestationFormat: c.AttestationFmt,
+        Transport:         transports,
+        Flags:             webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(c.Flags)),
+        Authenticator: webauthn.Authenticator{
+            AAGUID:    c.AAGUID,
+            SignCount: c.SignCount,
+        },
+    }
+}
+
+func fromLibraryCredential(c *webauthn.Credential) models.WebAuthnCredential {
+    transports := make([]string, len(c.Transport))
+    for i, t := range c.Transport {
+        transports[i] = string(t)
+    }
+
+    return models.WebAuthnCredential{
+        CredentialID:    c.ID,
+        PublicKey:       c.PublicKey,
+        AttestationType: c.AttestationType,
+        AttestationFmt:  c.AttestationFormat,
+        Transports:      transports,
+        AAGUID:          c.Authenticator.AAGUID,
+        Flags:           uint8(c.Flags.ProtocolValue()),
+        SignCount:       c.Authenticator.SignCount,
+    }
+}
+
+// PasskeyUserVerified reports whether the authenticator verified the user
+// (biometric or PIN) on its last use, making the passkey multi-factor
+func PasskeyUserVerified(c *models.WebAuthnCredential) bool {
+    return protocol.AuthenticatorFlags(c.Flags).HasUserVerified()
+}
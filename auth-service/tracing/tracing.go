@@ -0,0 +1,92 @@
+// Package tracing sets up OpenTelemetry: the tracer provider and exporter,
+// W3C trace context propagation, and the Gin and MongoDB instrumentation.
+package tracing
+
+import (
+    "context"
+    "fmt"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/event"
+    "go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+    "go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Anurag-spec1/goauthenticate"
+
+// Init installs the global tracer provider, naming spans' service
+// serviceName. exporter is one of:
+//
+//   - "otlp" sends spans over OTLP/HTTP to endpoint, otherwise configured
+//     by the standard OTEL_EXPORTER_OTLP_* variables.
+//   - "stdout" prints spans, for local runs.
+//   - "none" records nothing.
+//
+// The config package resolves which one applies. The returned function
+// flushes and stops the exporter.
+func Init(ctx context.Context, serviceName, exporterName, endpoint string) (func(context.Context) error, error) {
+    otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+        propagation.TraceContext{},
+        propagation.Baggage{},
+    ))
+
+    var exporter sdktrace.SpanExporter
+    var err error
+    switch exporterName {
+    case "otlp":
+        var opts []otlptracehttp.Option
+        if endpoint != "" {
+            opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+        }
+        exporter, err = otlptracehttp.New(ctx, opts...)
+    case "stdout":
+        exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+    case "", "none":
+        return func(context.Context) error { return nil }, nil
+    default:
+        return nil, fmt.Errorf("unknown trace exporter %q", exporterName)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+        attribute.String("service.name", serviceName),
+    ))
+    if err != nil {
+        return nil, err
+    }
+
+    provider := sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithResource(res),
+    )
+    otel.SetTracerProvider(provider)
+
+    return provider.Shutdown, nil
+}
+
+// Middleware starts a span per request, continuing the trace from the
+// incoming traceparent header if there is one
+func Middleware(serviceName string) gin.HandlerFunc {
+    return otelgin.Middleware(serviceName)
+}
+
+// MongoMonitor starts a span per MongoDB command. Command bodies are left
+// out of the spans since they carry OTPs, tokens and email addresses.
+func MongoMonitor() *event.CommandMonitor {
+    return otelmongo.NewMonitor(otelmongo.WithCommandAttributeDisabled(true))
+}
+
+// Start begins a span for work inside the service, such as an email send
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+    return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
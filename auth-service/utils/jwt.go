@@ -1,69 +1,93 @@
 package utils
 
 import (
-    "os"
+    "crypto/hmac"
+    "crypto/sha256"
+    "errors"
     "time"
     "github.com/golang-jwt/jwt/v5"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+    "github.com/Anurag-spec1/goauthenticate/metrics"
 )
 
-func GenerateAccessToken(userID string) (string, error) {
-    secret := os.Getenv("ACCESS_SECRET")
-    if secret == "" {
-        secret = "myaccesssecret"
+var errJWTNotConfigured = errors.New("JWT secrets are not configured")
+
+// TokenTTL is the configured lifetime of refresh tokens, or of access tokens
+func TokenTTL(cfg config.JWTConfig, refresh bool) time.Duration {
+    if refresh {
+        return cfg.RefreshTTL.Std()
+    }
+    return cfg.AccessTTL.Std()
+}
+
+// DeriveKey returns a key for label derived from the access secret, for
+// features that need their own HMAC key without another secret to manage
+func DeriveKey(cfg config.JWTConfig, label string) []byte {
+    mac := hmac.New(sha256.New, []byte(cfg.AccessSecret))
+    mac.Write([]byte(label))
+    return mac.Sum(nil)
+}
+
+func GenerateAccessToken(cfg config.JWTConfig, userID string) (string, error) {
+    secret := cfg.AccessSecret
+
+    jti, err := newTokenID()
+    if err != nil {
+        return "", err
     }
 
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
         "user_id": userID,
-        "exp":     time.Now().Add(15 * time.Minute).Unix(),
+        "exp":     time.Now().Add(cfg.AccessTTL.Std()).Unix(),
         "iat":     time.Now().Unix(),
         "type":    "access",
+        "jti":     jti,
     })
 
-    return token.SignedString([]byte(secret))
+    return signToken(token, secret, "access")
 }
 
-func GenerateRefreshToken(userID string) (string, error) {
-    secret := os.Getenv("REFRESH_SECRET")
-    if secret == "" {
-        secret = "myrefreshsecret"
+func GenerateRefreshToken(cfg config.JWTConfig, userID string) (string, error) {
+    secret := cfg.RefreshSecret
+
+    jti, err := newTokenID()
+    if err != nil {
+        return "", err
     }
 
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
         "user_id": userID,
-        "exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
+        "exp":     time.Now().Add(cfg.RefreshTTL.Std()).Unix(),
         "iat":     time.Now().Unix(),
         "type":    "refresh",
+        "jti":     jti,
     })
 
-    return token.SignedString([]byte(secret))
+    return signToken(token, secret, "refresh")
 }
 
-func ParseToken(tokenString string, isRefresh bool) (*jwt.Token, error) {
-    var secret string
+func ParseToken(cfg config.JWTConfig, tokenString string, isRefresh bool) (*jwt.Token, error) {
+    secret := cfg.AccessSecret
     if isRefresh {
-        secret = os.Getenv("REFRESH_SECRET")
-        if secret == "" {
-            secret = "myrefreshsecret"
-        }
-    } else {
-        secret = os.Getenv("ACCESS_SECRET")
-        if secret == "" {
-            secret = "myaccesssecret"
-        }
+        secret = cfg.RefreshSecret
     }
 
     token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
         if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
             return nil, jwt.ErrSignatureInvalid
         }
+        if secret == "" {
+            return nil, errJWTNotConfigured
+        }
         return []byte(secret), nil
     })
 
     return token, err
 }
 
-func ExtractUserIDFromToken(tokenString string, isRefresh bool) (string, error) {
-    token, err := ParseToken(tokenString, isRefresh)
+func ExtractUserIDFromToken(cfg config.JWTConfig, tokenString string, isRefresh bool) (string, error) {
+    token, err := ParseToken(cfg, tokenString, isRefresh)
     if err != nil {
         return "", err
     }
@@ -75,4 +99,209 @@ func ExtractUserIDFromToken(tokenString string, isRefresh bool) (string, error)
     }
     
     return "", jwt.ErrInvalidKey
-}
\ No newline at end of file
+}
+
+// GenerateMagicLinkToken signs a single-use login link token. The nonce must
+// also be stored on the OTP challenge so the link can only be redeemed once.
+func GenerateMagicLinkToken(cfg config.JWTConfig, userID, nonce string, expiresAt time.Time) (string, error) {
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "user_id": userID,
+        "nonce":   nonce,
+        "exp":     expiresAt.Unix(),
+        "iat":     time.Now().Unix(),
+        "type":    "magic_link",
+    })
+
+    return signToken(token, cfg.MagicLinkSecret, "magic_link")
+}
+
+// ParseMagicLinkToken validates a magic link token and returns its user ID and nonce
+func ParseMagicLinkToken(cfg config.JWTConfig, tokenString string) (string, string, error) {
+    token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+            return nil, jwt.ErrSignatureInvalid
+        }
+        if cfg.MagicLinkSecret == "" {
+            return nil, errJWTNotConfigured
+        }
+        return []byte(cfg.MagicLinkSecret), nil
+    })
+    if err != nil {
+        return "", "", err
+    }
+
+    claims, ok := token.Claims.(jwt.MapClaims)
+    if !ok || !token.Valid || claims["type"] != "magic_link" {
+        return "", "", jwt.ErrTokenInvalidClaims
+    }
+
+    userID, _ := claims["user_id"].(string)
+    nonce, _ := claims["nonce"].(string)
+    if userID == "" || nonce == "" {
+        return "", "", jwt.ErrTokenInvalidClaims
+    }
+
+    return userID, nonce, nil
+}
+
+// GenerateMFAToken issues the partial token, valid for cfg.MFATTL, returned
+// by VerifyOTP when the user still has to present a second factor. It is not
+// an access token and AuthMiddleware rejects it. Its jti lets VerifyMFA
+// revoke it once used or after a lockout.
+func GenerateMFAToken(cfg config.JWTConfig, userID string) (string, error) {
+    secret := cfg.AccessSecret
+
+    jti, err := newTokenID()
+    if err != nil {
+        return "", err
+    }
+
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "user_id": userID,
+        "exp":     time.Now().Add(cfg.MFATTL.Std()).Unix(),
+        "iat":     time.Now().Unix(),
+        "type":    "mfa_required",
+        "jti":     jti,
+    })
+
+    return signToken(token, secret, "mfa")
+}
+
+// ParseMFAToken validates a partial MFA token and returns its user ID, its
+// jti and when it expires
+func ParseMFAToken(cfg config.JWTConfig, tokenString string) (string, string, time.Time, error) {
+    token, err := ParseToken(cfg, tokenString, false)
+    if err != nil {
+        return "", "", time.Time{}, err
+    }
+
+    claims, ok := token.Claims.(jwt.MapClaims)
+    if !ok || !token.Valid || claims["type"] != "mfa_required" {
+        return "", "", time.Time{}, jwt.ErrTokenInvalidClaims
+    }
+
+    userID, _ := claims["user_id"].(string)
+    jti, _ := claims["jti"].(string)
+    exp, err := claims.GetExpirationTime()
+    if userID == "" || jti == "" || err != nil || exp == nil {
+        return "", "", time.Time{}, jwt.ErrTokenInvalidClaims
+    }
+
+    return userID, jti, exp.Time, nil
+}
+
+// GenerateClientAccessToken issues an access token for a user on behalf of
+// an OAuth client. It is a regular access token that also records which
+// client it was issued to and the scopes the user granted.
+func GenerateClientAccessToken(cfg config.JWTConfig, userID, clientID, scope string, ttl time.Duration) (string, error) {
+    secret := cfg.AccessSecret
+
+    jti, err := newTokenID()
+    if err != nil {
+        return "", err
+    }
+
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "user_id":   userID,
+        "client_id": clientID,
+        "scope":     scope,
+        "exp":       time.Now().Add(ttl).Unix(),
+        "iat":       time.Now().Unix(),
+        "type":      "access",
+        "jti":       jti,
+    })
+
+    return signToken(token, secret, "client_access")
+}
+
+// GenerateServiceToken issues a client_credentials access token. It has no
+// user: the client itself is the subject, marked by subject_type "client".
+func GenerateServiceToken(cfg config.JWTConfig, clientID, scope string, ttl time.Duration) (string, error) {
+    secret := cfg.AccessSecret
+
+    jti, err := newTokenID()
+    if err != nil {
+        return "", err
+    }
+
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "sub":          clientID,
+        "subject_type": "client",
+        "client_id":    clientID,
+        "scope":        scope,
+        "exp":          time.Now().Add(ttl).Unix(),
+        "iat":          time.Now().Unix(),
+        "type":         "access",
+        "jti":          jti,
+    })
+
+    return signToken(token, secret, "service")
+}
+
+// GenerateDelegatedToken issues the result of a token exchange: an access
+// token for userID that only audience should accept, with act naming the
+// service acting on the user's behalf (and any actor before it)
+func GenerateDelegatedToken(cfg config.JWTConfig, userID, clientID, audience, scope string, act map[string]interface{}, ttl time.Duration) (string, error) {
+    secret := cfg.AccessSecret
+
+    jti, err := newTokenID()
+    if err != nil {
+        return "", err
+    }
+
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "user_id":   userID,
+        "client_id": clientID,
+        "aud":       audience,
+        "scope":     scope,
+        "act":       act,
+        "exp":       time.Now().Add(ttl).Unix(),
+        "iat":       time.Now().Unix(),
+        "type":      "access",
+        "jti":       jti,
+    })
+
+    return signToken(token, secret, "delegated")
+}
+
+// GenerateImpersonationToken issues a short-lived access token for userID
+// on behalf of the admin impersonatorID. It is never paired with a refresh
+// token, so it cannot outlive ttl.
+func GenerateImpersonationToken(cfg config.JWTConfig, userID, impersonatorID string, ttl time.Duration) (string, string, error) {
+    secret := cfg.AccessSecret
+
+    jti, err := newTokenID()
+    if err != nil {
+        return "", "", err
+    }
+
+    token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "user_id":      userID,
+        "impersonator": impersonatorID,
+        "exp":          time.Now().Add(ttl).Unix(),
+        "iat":          time.Now().Unix(),
+        "type":         "access",
+        "jti":          jti,
+    })
+
+    signed, err := signToken(token, secret, "impersonation")
+    return signed, jti, err
+}
+
+// signToken signs with the shared secret and counts the token by kind
+func signToken(token *jwt.Token, secret, kind string) (string, error) {
+    if secret == "" {
+        return "", errJWTNotConfigured
+    }
+    signed, err := token.SignedString([]byte(secret))
+    if err == nil {
+        metrics.TokensIssued.WithLabelValues(kind).Inc()
+    }
+    return signed, err
+}
+
+// newTokenID returns a unique jti claim, so individual access and refresh
+// tokens can be revoked
+func newTokenID() (string, error) {
+    return GenerateSecureToken(16)
+}
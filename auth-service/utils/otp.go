@@ -1,29 +1,80 @@
 package utils
 
 import (
+    "crypto/hmac"
     "crypto/rand"
-    "fmt"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
     "math/big"
+    "strings"
     "time"
+
+    "github.com/Anurag-spec1/goauthenticate/config"
+)
+
+const (
+    otpDigits = "0123456789"
+    // Letters and digits that can't be mistaken for each other (no 0/O, 1/I/L)
+    otpAlphanumeric = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
 )
 
-func GenerateOTP() string {
-    // Generate 6-digit OTP
-    max := big.NewInt(1000000)
-    n, err := rand.Int(rand.Reader, max)
-    if err != nil {
-        // Fallback to timestamp-based OTP
-        return fmt.Sprintf("%06d", time.Now().UnixNano()%1000000)
+// GenerateOTP returns a random code of the policy's length and alphabet
+func GenerateOTP(policy config.OTPConfig) (string, error) {
+    alphabet := otpDigits
+    if policy.Alphabet == config.OTPAlphanumeric {
+        alphabet = otpAlphanumeric
+    }
+
+    max := big.NewInt(int64(len(alphabet)))
+    code := make([]byte, policy.Length)
+    for i := range code {
+        n, err := rand.Int(rand.Reader, max)
+        if err != nil {
+            return "", err
+        }
+        code[i] = alphabet[n.Int64()]
+    }
+    return string(code), nil
+}
+
+// NormalizeOTP tidies a code as typed by the user: surrounding spaces go,
+// and alphanumeric codes are case-insensitive. It returns "" if the result
+// can't be a code under the policy.
+func NormalizeOTP(code string, policy config.OTPConfig) string {
+    code = strings.TrimSpace(code)
+    alphabet := otpDigits
+    if policy.Alphabet == config.OTPAlphanumeric {
+        code = strings.ToUpper(code)
+        alphabet = otpAlphanumeric
+    }
+
+    if len(code) != policy.Length {
+        return ""
+    }
+    for _, r := range code {
+        if !strings.ContainsRune(alphabet, r) {
+            return ""
+        }
     }
-    return fmt.Sprintf("%06d", n.Int64())
+    return code
 }
 
-func IsOTPValid(storedOTP, providedOTP string, expiresAt time.Time) bool {
-    if storedOTP == "" || providedOTP == "" {
+// HashOTP is how codes are stored. It is keyed so a leaked challenge
+// collection can't be brute forced offline in a few milliseconds.
+func HashOTP(cfg config.JWTConfig, code string) string {
+    mac := hmac.New(sha256.New, DeriveKey(cfg, "otp"))
+    mac.Write([]byte(code))
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsOTPValid checks providedOTP against a hash from HashOTP
+func IsOTPValid(cfg config.JWTConfig, storedHash, providedOTP string, expiresAt time.Time) bool {
+    if storedHash == "" || providedOTP == "" {
         return false
     }
-    if storedOTP != providedOTP {
+    if subtle.ConstantTimeCompare([]byte(storedHash), []byte(HashOTP(cfg, providedOTP))) != 1 {
         return false
     }
     return time.Now().Before(expiresAt)
-}
\ No newline at end of file
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+    "crypto/rand"
+    "strings"
+)
+
+// Unambiguous lowercase alphabet (no 0/o, 1/l/i) so codes survive being
+// written down and typed back in
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes returns n single-use MFA recovery codes formatted
+// as xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+    codes := make([]string, n)
+    for i := range codes {
+        code, err := randomFromAlphabet(recoveryAlphabet, 10)
+        if err != nil {
+            return nil, err
+        }
+        codes[i] = code[:5] + "-" + code[5:]
+    }
+    return codes, nil
+}
+
+// Consonants only, so device user codes are easy to read out and never
+// spell words (RFC 8628 section 6.1)
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// GenerateUserCode returns a device flow user code formatted as XXXX-XXXX
+func GenerateUserCode() (string, error) {
+    code, err := randomFromAlphabet(userCodeAlphabet, 8)
+    if err != nil {
+        return "", err
+    }
+    return code[:4] + "-" + code[4:], nil
+}
+
+// NormalizeUserCode puts a user code typed by a person back into XXXX-XXXX
+// form, ignoring case, spaces and dashes
+func NormalizeUserCode(code string) string {
+    code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+    if len(code) != 8 {
+        return code
+    }
+    return code[:4] + "-" + code[4:]
+}
+
+// randomFromAlphabet draws length characters uniformly from alphabet,
+// rejecting bytes that would bias the modulo
+func randomFromAlphabet(alphabet string, length int) (string, error) {
+    limit := 256 - 256%len(alphabet)
+    out := make([]byte, 0, length)
+    buf := make([]byte, length)
+
+    for len(out) < length {
+        if _, err := rand.Read(buf); err != nil {
+            return "", err
+        }
+        for _, b := range buf {
+            if int(b) < limit && len(out) < length {
+                out = append(out, alphabet[int(b)%len(alphabet)])
+            }
+        }
+    }
+    return string(out), nil
+}
+
+// HashRecoveryCode normalises a code as typed by the user and hashes it for
+// storage and lookup
+func HashRecoveryCode(code string) string {
+    code = strings.ToLower(code)
+    code = strings.NewReplacer("-", "", " ", "").Replace(code)
+    return HashToken(code)
+}
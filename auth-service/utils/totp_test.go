@@ -0,0 +1,62 @@
+package utils
+
+import (
+    "testing"
+    "time"
+)
+
+// The RFC 6238 appendix B secret, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+    tests := []struct {
+        name     string
+        secret   string
+        code     string
+        at       int64
+        wantStep int64
+        wantOK   bool
+    }{
+        // Codes are the last six digits of the RFC 6238 SHA-1 vectors
+        {"rfc vector at 59", rfc6238Secret, "287082", 59, 1, true},
+        {"rfc vector at 1111111109", rfc6238Secret, "081804", 1111111109, 37037036, true},
+        {"rfc vector at 1234567890", rfc6238Secret, "005924", 1234567890, 41152263, true},
+        {"rfc vector at 2000000000", rfc6238Secret, "279037", 2000000000, 66666666, true},
+        {"surrounding spaces", rfc6238Secret, " 287082 ", 59, 1, true},
+        {"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", 59, 1, true},
+        {"one step late", rfc6238Secret, "287082", 89, 1, true},
+        {"one step early", rfc6238Secret, "287082", 29, 1, true},
+        {"two steps late", rfc6238Secret, "287082", 119, 0, false},
+        {"wrong code", rfc6238Secret, "287083", 59, 0, false},
+        {"too short", rfc6238Secret, "28708", 59, 0, false},
+        {"eight digits", rfc6238Secret, "94287082", 59, 0, false},
+        {"empty", rfc6238Secret, "", 59, 0, false},
+        {"invalid secret", "not base32!", "287082", 59, 0, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            step, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.at, 0))
+            if ok != tt.wantOK || step != tt.wantStep {
+                t.Errorf("ValidateTOTP(%q, %q, %d) = (%d, %v), want (%d, %v)",
+                    tt.secret, tt.code, tt.at, step, ok, tt.wantStep, tt.wantOK)
+            }
+        })
+    }
+}
+
+func TestTOTPCodeRoundTrip(t *testing.T) {
+    secret, err := GenerateTOTPSecret()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    now := time.Now()
+    code, err := TOTPCode(secret, now)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := ValidateTOTP(secret, code, now); !ok {
+        t.Errorf("code %q generated for a fresh secret did not validate", code)
+    }
+}